@@ -0,0 +1,874 @@
+// Package aria2test provides an in-process fake of the aria2 json-rpc server for tests,
+// it serves both http and websocket requests and sends the notifications over websocket.
+package aria2test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// statuses of Task.
+const (
+	StatusActive   = "active"
+	StatusWaiting  = "waiting"
+	StatusPaused   = "paused"
+	StatusError    = "error"
+	StatusComplete = "complete"
+	StatusRemoved  = "removed"
+)
+
+// Task is a download of the fake server.
+type Task struct {
+	Gid             string
+	Status          string
+	TotalLength     int64
+	CompletedLength int64
+	ErrorCode       int
+	ErrorMessage    string
+	Uris            []string
+	Options         map[string]string
+}
+
+// Error is the error object of a json-rpc response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server is a fake aria2 server, the json-rpc endpoint is served on any path.
+type Server struct {
+	*httptest.Server
+	secret   string
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	requests int
+	lastGid  int
+	tasks    map[string]*Task
+	// order is the gids in the order of the queue.
+	order []string
+	// stopped is the gids in the order they were stopped.
+	stopped       []string
+	globalOptions map[string]string
+	saved         int
+	shutdown      string
+	conns         map[*websocket.Conn]*sync.Mutex
+}
+
+// Version is the version of aria2 returned by aria2.getVersion.
+const Version = "1.36.0"
+
+// SessionID is the session id returned by aria2.getSessionInfo.
+const SessionID = "cd6a3bc6a1de28eb5bfa181e5f6b916d44af31a9"
+
+// NewServer starts and returns a new Server with the secret, the caller should call Close when finished.
+func NewServer(secret string) *Server {
+	s := &Server{
+		secret:        secret,
+		tasks:         make(map[string]*Task),
+		globalOptions: map[string]string{"dir": "/downloads", "max-concurrent-downloads": "5"},
+		conns:         make(map[*websocket.Conn]*sync.Mutex),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint returns the http endpoint of json-rpc.
+func (s *Server) Endpoint() string {
+	return s.URL + "/jsonrpc"
+}
+
+// WSEndpoint returns the websocket endpoint of json-rpc.
+func (s *Server) WSEndpoint() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/jsonrpc"
+}
+
+// Requests returns the count of json-rpc requests served, a batch of system.multicall counts 1.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Task returns a copy of the task.
+func (s *Server) Task(gid string) (*Task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[gid]
+	if !ok {
+		return nil, false
+	}
+	t := *task
+	return &t, true
+}
+
+// GlobalOptions returns a copy of the global options.
+func (s *Server) GlobalOptions() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyOptions(s.globalOptions)
+}
+
+// SavedSessions returns the count of aria2.saveSession calls.
+func (s *Server) SavedSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saved
+}
+
+// ShutdownMethod returns the method shutting down the server, aria2.shutdown or aria2.forceShutdown,
+// it's empty if the server is not shut down. The server keeps serving after the shutdown.
+func (s *Server) ShutdownMethod() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
+func copyOptions(options map[string]string) map[string]string {
+	m := make(map[string]string, len(options))
+	for k, v := range options {
+		m[k] = v
+	}
+	return m
+}
+
+// AddTask adds the task, the gid is generated if it's empty, the status is active if it's empty.
+func (s *Server) AddTask(task *Task) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addTask(task)
+}
+
+func (s *Server) addTask(task *Task) string {
+	if task.Gid == "" {
+		s.lastGid++
+		task.Gid = fmt.Sprintf("%016x", s.lastGid)
+	}
+	if task.Status == "" {
+		task.Status = StatusActive
+	}
+	if task.Options == nil {
+		task.Options = make(map[string]string)
+	}
+	s.tasks[task.Gid] = task
+	s.order = append(s.order, task.Gid)
+	if isStopped(task.Status) {
+		s.stopped = append(s.stopped, task.Gid)
+	}
+	return task.Gid
+}
+
+// SetStatus changes the status of the task and sends the notification of it.
+func (s *Server) SetStatus(gid, status, errorMessage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[gid]
+	if !ok {
+		return
+	}
+	s.setStatus(task, status)
+	if status == StatusError {
+		task.ErrorCode, task.ErrorMessage = 1, errorMessage
+	}
+	if status == StatusComplete {
+		task.CompletedLength = task.TotalLength
+	}
+}
+
+// setStatus changes the status of the task and sends the notification, it must be called with mu held.
+func (s *Server) setStatus(task *Task, status string) {
+	if !isStopped(task.Status) && isStopped(status) {
+		s.stopped = append(s.stopped, task.Gid)
+	}
+	task.Status = status
+	event := map[string]string{
+		StatusActive:   "aria2.onDownloadStart",
+		StatusPaused:   "aria2.onDownloadPause",
+		StatusRemoved:  "aria2.onDownloadStop",
+		StatusComplete: "aria2.onDownloadComplete",
+		StatusError:    "aria2.onDownloadError",
+	}[status]
+	if event != "" {
+		s.notify(event, task.Gid)
+	}
+}
+
+func isStopped(status string) bool {
+	return status == StatusComplete || status == StatusError || status == StatusRemoved
+}
+
+// Delete deletes the task without any notification, like it's purged by another client.
+func (s *Server) Delete(gid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(gid)
+}
+
+// delete deletes the task, it must be called with mu held.
+func (s *Server) delete(gid string) {
+	delete(s.tasks, gid)
+	s.order = removeGid(s.order, gid)
+	s.stopped = removeGid(s.stopped, gid)
+}
+
+func removeGid(gids []string, gid string) []string {
+	for i, g := range gids {
+		if g == gid {
+			return append(gids[:i:i], gids[i+1:]...)
+		}
+	}
+	return gids
+}
+
+// DropConnections closes all websocket connections.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// notify sends the notification to all websocket connections, it must be called with mu held.
+func (s *Server) notify(event, gid string) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  event,
+		"params":  []map[string]string{{"gid": gid}},
+	})
+	for conn, writeMu := range s.conns {
+		writeMu.Lock()
+		conn.WriteMessage(websocket.TextMessage, b)
+		writeMu.Unlock()
+	}
+}
+
+type request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWS(w, r)
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, failed := s.handle(b)
+	w.Header().Set("Content-Type", "application/json")
+	// like aria2, the errors of the rpc are responded with http status 400.
+	if failed {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	w.Write(resp)
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	writeMu := new(sync.Mutex)
+	s.mu.Lock()
+	s.conns[conn] = writeMu
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		resp, _ := s.handle(b)
+		writeMu.Lock()
+		err = conn.WriteMessage(websocket.TextMessage, resp)
+		writeMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle handles a json-rpc request and returns the encoded response, failed is true if it's an error.
+func (s *Server) handle(b []byte) (_ []byte, failed bool) {
+	var req request
+	var resp response
+	if err := json.Unmarshal(b, &req); err != nil {
+		resp = response{Error: &Error{Code: -32700, Message: "Parse error."}}
+	} else {
+		s.mu.Lock()
+		s.requests++
+		result, rpcErr := s.call(req.Method, req.Params)
+		s.mu.Unlock()
+		resp = response{ID: req.ID, Result: result, Error: rpcErr}
+	}
+	resp.JSONRPC = "2.0"
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	b, _ = json.Marshal(resp)
+	return b, resp.Error != nil
+}
+
+// call calls the method with the params, it must be called with mu held.
+func (s *Server) call(method string, params []json.RawMessage) (interface{}, *Error) {
+	switch method {
+	case "system.multicall":
+		return s.multicall(params)
+	case "system.listMethods":
+		names := []string{"system.multicall", "system.listMethods", "system.listNotifications"}
+		for name := range methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	case "system.listNotifications":
+		return []string{
+			"aria2.onDownloadStart", "aria2.onDownloadPause", "aria2.onDownloadStop",
+			"aria2.onDownloadComplete", "aria2.onDownloadError", "aria2.onBtDownloadComplete",
+		}, nil
+	}
+	if s.secret != "" {
+		var token string
+		if len(params) > 0 {
+			json.Unmarshal(params[0], &token)
+		}
+		if token != "token:"+s.secret {
+			return nil, &Error{Code: 1, Message: "Unauthorized"}
+		}
+		params = params[1:]
+	}
+	handler, ok := methods[method]
+	if !ok {
+		return nil, &Error{Code: 1, Message: fmt.Sprintf("No such method: %s", method)}
+	}
+	return handler(s, params)
+}
+
+// multicall calls the methods in the params, the result of each call is an array of the result or a fault struct.
+func (s *Server) multicall(params []json.RawMessage) (interface{}, *Error) {
+	var calls []struct {
+		MethodName string            `json:"methodName"`
+		Params     []json.RawMessage `json:"params"`
+	}
+	if err := param(params, 0, &calls); err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(calls))
+	for _, call := range calls {
+		if call.MethodName == "system.multicall" {
+			results = append(results, errorf("Recursive system.multicall forbidden."))
+			continue
+		}
+		result, err := s.call(call.MethodName, call.Params)
+		if err != nil {
+			results = append(results, err)
+			continue
+		}
+		results = append(results, []interface{}{result})
+	}
+	return results, nil
+}
+
+func errorf(format string, args ...interface{}) *Error {
+	return &Error{Code: 1, Message: fmt.Sprintf(format, args...)}
+}
+
+// methods are the handlers of the json-rpc methods, the params are without the token.
+var methods = map[string]func(s *Server, params []json.RawMessage) (interface{}, *Error){
+	"aria2.addUri":               (*Server).addUri,
+	"aria2.tellStatus":           (*Server).tellStatus,
+	"aria2.remove":               (*Server).remove,
+	"aria2.forceRemove":          (*Server).remove,
+	"aria2.pause":                (*Server).pause,
+	"aria2.forcePause":           (*Server).pause,
+	"aria2.unpause":              (*Server).unpause,
+	"aria2.getUris":              (*Server).getUris,
+	"aria2.getFiles":             (*Server).getFiles,
+	"aria2.getServers":           (*Server).getServers,
+	"aria2.tellActive":           (*Server).tellActive,
+	"aria2.tellWaiting":          (*Server).tellWaiting,
+	"aria2.tellStopped":          (*Server).tellStopped,
+	"aria2.changePosition":       (*Server).changePosition,
+	"aria2.changeUri":            (*Server).changeUri,
+	"aria2.getOption":            (*Server).getOption,
+	"aria2.changeOption":         (*Server).changeOption,
+	"aria2.getGlobalOption":      (*Server).getGlobalOption,
+	"aria2.changeGlobalOption":   (*Server).changeGlobalOption,
+	"aria2.getGlobalStat":        (*Server).getGlobalStat,
+	"aria2.purgeDownloadResult":  (*Server).purgeDownloadResult,
+	"aria2.removeDownloadResult": (*Server).removeDownloadResult,
+	"aria2.getVersion":           (*Server).getVersion,
+	"aria2.getSessionInfo":       (*Server).getSessionInfo,
+	"aria2.shutdown":             (*Server).shutdownServer,
+	"aria2.forceShutdown":        (*Server).forceShutdown,
+	"aria2.saveSession":          (*Server).saveSession,
+}
+
+// param decodes the i-th param into v, it's left untouched if the param is absent.
+func param(params []json.RawMessage, i int, v interface{}) *Error {
+	if i >= len(params) {
+		return nil
+	}
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return &Error{Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
+// task returns the task of the gid in the first param.
+func (s *Server) task(params []json.RawMessage) (*Task, *Error) {
+	var gid string
+	if err := param(params, 0, &gid); err != nil {
+		return nil, err
+	}
+	task, ok := s.tasks[gid]
+	if !ok {
+		return nil, errorf("GID %s is not found", gid)
+	}
+	return task, nil
+}
+
+func (s *Server) addUri(params []json.RawMessage) (interface{}, *Error) {
+	task := &Task{Status: StatusWaiting}
+	if err := param(params, 0, &task.Uris); err != nil {
+		return nil, err
+	}
+	if len(task.Uris) == 0 {
+		return nil, errorf("No URI to download.")
+	}
+	if err := param(params, 1, &task.Options); err != nil {
+		return nil, err
+	}
+	return s.addTask(task), nil
+}
+
+func (s *Server) tellStatus(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := param(params, 1, &keys); err != nil {
+		return nil, err
+	}
+	return filterKeys(task.status(), keys), nil
+}
+
+func (s *Server) remove(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	if isStopped(task.Status) {
+		return nil, errorf("Active Download not found for GID#%s", task.Gid)
+	}
+	s.setStatus(task, StatusRemoved)
+	return task.Gid, nil
+}
+
+func (s *Server) pause(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != StatusActive && task.Status != StatusWaiting {
+		return nil, errorf("GID#%s cannot be paused now", task.Gid)
+	}
+	s.setStatus(task, StatusPaused)
+	return task.Gid, nil
+}
+
+func (s *Server) unpause(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != StatusPaused {
+		return nil, errorf("GID#%s cannot be unpaused now", task.Gid)
+	}
+	s.setStatus(task, StatusWaiting)
+	return task.Gid, nil
+}
+
+func (s *Server) getUris(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	return task.uris(), nil
+}
+
+func (s *Server) getFiles(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	return task.files(), nil
+}
+
+// getServers returns every uri of the active task as a server.
+func (s *Server) getServers(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != StatusActive {
+		return nil, errorf("No active download for GID#%s", task.Gid)
+	}
+	servers := make([]map[string]string, 0, len(task.Uris))
+	for _, uri := range task.Uris {
+		servers = append(servers, map[string]string{"uri": uri, "currentUri": uri, "downloadSpeed": "0"})
+	}
+	return []map[string]interface{}{{"index": "1", "servers": servers}}, nil
+}
+
+// list returns the statuses of the tasks with the keys in params[i].
+func (s *Server) list(gids []string, params []json.RawMessage, i int) (interface{}, *Error) {
+	var keys []string
+	if err := param(params, i, &keys); err != nil {
+		return nil, err
+	}
+	statuses := make([]map[string]interface{}, 0, len(gids))
+	for _, gid := range gids {
+		statuses = append(statuses, filterKeys(s.tasks[gid].status(), keys))
+	}
+	return statuses, nil
+}
+
+// filter returns the gids of the tasks in the queue order which match the function.
+func (s *Server) filter(match func(task *Task) bool) []string {
+	var gids []string
+	for _, gid := range s.order {
+		if match(s.tasks[gid]) {
+			gids = append(gids, gid)
+		}
+	}
+	return gids
+}
+
+// waiting returns the gids of the waiting and paused tasks in the queue order.
+func (s *Server) waiting() []string {
+	return s.filter(func(task *Task) bool {
+		return task.Status == StatusWaiting || task.Status == StatusPaused
+	})
+}
+
+func (s *Server) tellActive(params []json.RawMessage) (interface{}, *Error) {
+	return s.list(s.filter(func(task *Task) bool {
+		return task.Status == StatusActive
+	}), params, 0)
+}
+
+// window returns the gids in [offset, offset+num), or in reverse order from the end if offset is negative.
+func window(gids []string, params []json.RawMessage) ([]string, *Error) {
+	var offset, num int
+	if err := param(params, 0, &offset); err != nil {
+		return nil, err
+	}
+	if err := param(params, 1, &num); err != nil {
+		return nil, err
+	}
+	var result []string
+	if offset >= 0 {
+		for i := offset; i < len(gids) && len(result) < num; i++ {
+			result = append(result, gids[i])
+		}
+	} else {
+		for i := len(gids) + offset; i >= 0 && len(result) < num; i-- {
+			result = append(result, gids[i])
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) tellWaiting(params []json.RawMessage) (interface{}, *Error) {
+	gids, err := window(s.waiting(), params)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(gids, params, 2)
+}
+
+func (s *Server) tellStopped(params []json.RawMessage) (interface{}, *Error) {
+	gids, err := window(s.stopped, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(gids, params, 2)
+}
+
+// changePosition moves the task in the waiting queue.
+func (s *Server) changePosition(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		pos int
+		how string
+	)
+	if err := param(params, 1, &pos); err != nil {
+		return nil, err
+	}
+	if err := param(params, 2, &how); err != nil {
+		return nil, err
+	}
+	waiting := s.waiting()
+	cur := -1
+	for i, gid := range waiting {
+		if gid == task.Gid {
+			cur = i
+		}
+	}
+	if cur < 0 {
+		return nil, errorf("GID#%s not found in the waiting queue.", task.Gid)
+	}
+	switch how {
+	case "POS_SET":
+	case "POS_CUR":
+		pos += cur
+	case "POS_END":
+		pos += len(waiting) - 1
+	default:
+		return nil, errorf("Illegal argument.")
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(waiting)-1 {
+		pos = len(waiting) - 1
+	}
+	waiting = removeGid(waiting, task.Gid)
+	waiting = append(waiting[:pos], append([]string{task.Gid}, waiting[pos:]...)...)
+	// the waiting tasks take the places of the waiting tasks in the queue in the new order.
+	next := 0
+	for i, gid := range s.order {
+		if status := s.tasks[gid].Status; status == StatusWaiting || status == StatusPaused {
+			s.order[i] = waiting[next]
+			next++
+		}
+	}
+	return pos, nil
+}
+
+func (s *Server) changeUri(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		fileIndex        int
+		delUris, addUris []string
+		position         = -1
+	)
+	for i, v := range []interface{}{&fileIndex, &delUris, &addUris, &position} {
+		if err := param(params, i+1, v); err != nil {
+			return nil, err
+		}
+	}
+	if fileIndex != 1 {
+		return nil, errorf("fileIndex is out of range")
+	}
+	deleted := 0
+	for _, uri := range delUris {
+		if uris := removeGid(task.Uris, uri); len(uris) < len(task.Uris) {
+			task.Uris = uris
+			deleted++
+		}
+	}
+	if position < 0 || position > len(task.Uris) {
+		position = len(task.Uris)
+	}
+	task.Uris = append(task.Uris[:position:position], append(addUris, task.Uris[position:]...)...)
+	return []int{deleted, len(addUris)}, nil
+}
+
+func (s *Server) getOption(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	options := copyOptions(s.globalOptions)
+	for k, v := range task.Options {
+		options[k] = v
+	}
+	return options, nil
+}
+
+func (s *Server) changeOption(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	options := make(map[string]string)
+	if err := param(params, 1, &options); err != nil {
+		return nil, err
+	}
+	for k, v := range options {
+		task.Options[k] = v
+	}
+	return "OK", nil
+}
+
+func (s *Server) getGlobalOption(params []json.RawMessage) (interface{}, *Error) {
+	return copyOptions(s.globalOptions), nil
+}
+
+func (s *Server) changeGlobalOption(params []json.RawMessage) (interface{}, *Error) {
+	options := make(map[string]string)
+	if err := param(params, 0, &options); err != nil {
+		return nil, err
+	}
+	for k, v := range options {
+		s.globalOptions[k] = v
+	}
+	return "OK", nil
+}
+
+func (s *Server) getGlobalStat(params []json.RawMessage) (interface{}, *Error) {
+	var active, waiting int
+	for _, task := range s.tasks {
+		switch task.Status {
+		case StatusActive:
+			active++
+		case StatusWaiting, StatusPaused:
+			waiting++
+		}
+	}
+	return map[string]string{
+		"downloadSpeed":   "0",
+		"uploadSpeed":     "0",
+		"numActive":       strconv.Itoa(active),
+		"numWaiting":      strconv.Itoa(waiting),
+		"numStopped":      strconv.Itoa(len(s.stopped)),
+		"numStoppedTotal": strconv.Itoa(len(s.stopped)),
+	}, nil
+}
+
+func (s *Server) purgeDownloadResult(params []json.RawMessage) (interface{}, *Error) {
+	for _, gid := range append([]string(nil), s.stopped...) {
+		s.delete(gid)
+	}
+	return "OK", nil
+}
+
+func (s *Server) removeDownloadResult(params []json.RawMessage) (interface{}, *Error) {
+	task, err := s.task(params)
+	if err != nil {
+		return nil, err
+	}
+	if !isStopped(task.Status) {
+		return nil, errorf("Could not remove download result of GID#%s", task.Gid)
+	}
+	s.delete(task.Gid)
+	return "OK", nil
+}
+
+func (s *Server) getVersion(params []json.RawMessage) (interface{}, *Error) {
+	return map[string]interface{}{
+		"version":         Version,
+		"enabledFeatures": []string{"Async DNS", "GZip", "HTTPS", "Message Digest", "XML-RPC"},
+	}, nil
+}
+
+func (s *Server) getSessionInfo(params []json.RawMessage) (interface{}, *Error) {
+	return map[string]string{"sessionId": SessionID}, nil
+}
+
+func (s *Server) shutdownServer(params []json.RawMessage) (interface{}, *Error) {
+	s.shutdown = "aria2.shutdown"
+	return "OK", nil
+}
+
+func (s *Server) forceShutdown(params []json.RawMessage) (interface{}, *Error) {
+	s.shutdown = "aria2.forceShutdown"
+	return "OK", nil
+}
+
+func (s *Server) saveSession(params []json.RawMessage) (interface{}, *Error) {
+	s.saved++
+	return "OK", nil
+}
+
+// uris returns the uris of aria2.getUris.
+func (t *Task) uris() []map[string]string {
+	uris := make([]map[string]string, 0, len(t.Uris))
+	for _, uri := range t.Uris {
+		uris = append(uris, map[string]string{"status": "used", "uri": uri})
+	}
+	return uris
+}
+
+// files returns the files of aria2.getFiles, a task has a single file.
+func (t *Task) files() []map[string]interface{} {
+	return []map[string]interface{}{{
+		"index":           "1",
+		"path":            t.Options["out"],
+		"length":          strconv.FormatInt(t.TotalLength, 10),
+		"completedLength": strconv.FormatInt(t.CompletedLength, 10),
+		"selected":        "true",
+		"uris":            t.uris(),
+	}}
+}
+
+// status returns the struct of aria2.tellStatus, the numbers are encoded as strings like aria2.
+func (t *Task) status() map[string]interface{} {
+	m := map[string]interface{}{
+		"gid":             t.Gid,
+		"status":          t.Status,
+		"totalLength":     strconv.FormatInt(t.TotalLength, 10),
+		"completedLength": strconv.FormatInt(t.CompletedLength, 10),
+		"uploadLength":    "0",
+		"downloadSpeed":   "0",
+		"uploadSpeed":     "0",
+		"connections":     "0",
+		"dir":             t.Options["dir"],
+		"files":           t.files(),
+	}
+	if t.Status == StatusError {
+		m["errorCode"] = strconv.Itoa(t.ErrorCode)
+		m["errorMessage"] = t.ErrorMessage
+	}
+	return m
+}
+
+// filterKeys returns the struct with the keys only, all keys are returned if keys is empty.
+func filterKeys(m map[string]interface{}, keys []string) map[string]interface{} {
+	if len(keys) == 0 {
+		return m
+	}
+	filtered := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if v, ok := m[key]; ok {
+			filtered[key] = v
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,193 @@
+package aria2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Batch is a batch of calls sent in one request by system.multicall, e.g.
+//
+//	results, err := client.Batch().TellStatus(gid1).TellStatus(gid2).Do()
+//
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	c     *Client
+	calls []*batchCall
+}
+
+type batchCall struct {
+	method string
+	params []interface{}
+	// newReply returns the pointer to decode the result into, nil if the result is ignored.
+	newReply func() interface{}
+	// value returns the Value of Result from the decoded reply.
+	value func(reply interface{}) interface{}
+}
+
+// Result is the result of a call of Batch.
+type Result struct {
+	Method string
+	// Value is the result of the call if Err is nil, its type is documented on the method of Batch.
+	Value interface{}
+	// Err is the error of the call, it's an *Error if the call is failed by aria2.
+	Err error
+}
+
+// Batch returns an empty batch of the client.
+func (c *Client) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+// Len returns the count of calls in the batch.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Call adds a call of the method, the Value of the Result is the reply decoded by json,
+// e.g. a map[string]interface{} for a struct.
+func (b *Batch) Call(method string, params ...interface{}) *Batch {
+	return b.add(method, params, func() interface{} {
+		return new(interface{})
+	}, func(reply interface{}) interface{} {
+		return *reply.(*interface{})
+	})
+}
+
+func (b *Batch) add(method string, params []interface{}, newReply func() interface{}, value func(interface{}) interface{}) *Batch {
+	b.calls = append(b.calls, &batchCall{method: method, params: params, newReply: newReply, value: value})
+	return b
+}
+
+// addGid adds a call with the gid which returns the gid, the Value of the Result is nil.
+func (b *Batch) addGid(method, gid string) *Batch {
+	return b.add(method, []interface{}{gid}, nil, nil)
+}
+
+// AddUri adds a call of AddUri, the Value of the Result is the gid string.
+func (b *Batch) AddUri(uris []string, options ...option) *Batch {
+	return b.add("aria2.addUri", []interface{}{uris, newOptions().applyOption(options...)}, func() interface{} {
+		return new(string)
+	}, func(reply interface{}) interface{} {
+		return *reply.(*string)
+	})
+}
+
+// Remove adds a call of Remove, the Value of the Result is nil.
+func (b *Batch) Remove(gid string) *Batch {
+	return b.addGid("aria2.remove", gid)
+}
+
+// ForceRemove adds a call of ForceRemove, the Value of the Result is nil.
+func (b *Batch) ForceRemove(gid string) *Batch {
+	return b.addGid("aria2.forceRemove", gid)
+}
+
+// Pause adds a call of Pause, the Value of the Result is nil.
+func (b *Batch) Pause(gid string) *Batch {
+	return b.addGid("aria2.pause", gid)
+}
+
+// ForcePause adds a call of ForcePause, the Value of the Result is nil.
+func (b *Batch) ForcePause(gid string) *Batch {
+	return b.addGid("aria2.forcePause", gid)
+}
+
+// Unpause adds a call of Unpause, the Value of the Result is nil.
+func (b *Batch) Unpause(gid string) *Batch {
+	return b.addGid("aria2.unpause", gid)
+}
+
+// TellStatus adds a call of TellStatus, the Value of the Result is a *TaskStatus.
+func (b *Batch) TellStatus(gid string, keys ...string) *Batch {
+	return b.add("aria2.tellStatus", withKeys([]interface{}{gid}, keys), func() interface{} {
+		return new(TaskStatus)
+	}, func(reply interface{}) interface{} {
+		return reply.(*TaskStatus)
+	})
+}
+
+// GetUris adds a call of GetUris, the Value of the Result is a []*Uri.
+func (b *Batch) GetUris(gid string) *Batch {
+	return b.add("aria2.getUris", []interface{}{gid}, func() interface{} {
+		return new([]*Uri)
+	}, func(reply interface{}) interface{} {
+		return *reply.(*[]*Uri)
+	})
+}
+
+// GetFiles adds a call of GetFiles, the Value of the Result is a []*File.
+func (b *Batch) GetFiles(gid string) *Batch {
+	return b.add("aria2.getFiles", []interface{}{gid}, func() interface{} {
+		return new([]*File)
+	}, func(reply interface{}) interface{} {
+		return *reply.(*[]*File)
+	})
+}
+
+// multicallMethod is a call in the params of system.multicall.
+type multicallMethod struct {
+	MethodName string        `json:"methodName"`
+	Params     []interface{} `json:"params"`
+}
+
+// Do sends the calls by system.multicall and returns the results in the order of the calls.
+// The error is returned only if the whole request fails, the errors of the calls are in the results.
+// An empty batch returns no result without a request.
+func (b *Batch) Do() ([]*Result, error) {
+	return b.DoContext(context.Background())
+}
+
+// DoContext is like Do but with a context.
+func (b *Batch) DoContext(ctx context.Context) ([]*Result, error) {
+	if len(b.calls) == 0 {
+		return nil, nil
+	}
+	methods := make([]*multicallMethod, 0, len(b.calls))
+	for _, call := range b.calls {
+		params := make([]interface{}, 0, len(call.params)+1)
+		if b.c.secret != "" {
+			params = append(params, fmt.Sprintf("token:%s", b.c.secret))
+		}
+		params = append(params, call.params...)
+		methods = append(methods, &multicallMethod{MethodName: call.method, Params: params})
+	}
+	// the token is in the params of each call instead of system.multicall itself.
+	var replies []json.RawMessage
+	if err := b.c.call(ctx, "system.multicall", []interface{}{methods}, &replies); err != nil {
+		return nil, err
+	}
+	if len(replies) != len(b.calls) {
+		return nil, fmt.Errorf("system.multicall returns %d results of %d calls", len(replies), len(b.calls))
+	}
+	results := make([]*Result, 0, len(b.calls))
+	for i, call := range b.calls {
+		result := &Result{Method: call.method}
+		result.Value, result.Err = call.decode(replies[i])
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// decode decodes the reply of the call, which is an array of the result or a fault struct.
+func (call *batchCall) decode(raw json.RawMessage) (interface{}, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		rpcErr := new(Error)
+		if err := json.Unmarshal(raw, rpcErr); err != nil {
+			return nil, err
+		}
+		return nil, rpcErr
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("unexpected result of %s: %s", call.method, raw)
+	}
+	if call.newReply == nil {
+		return nil, nil
+	}
+	reply := call.newReply()
+	if err := json.Unmarshal(values[0], reply); err != nil {
+		return nil, err
+	}
+	return call.value(reply), nil
+}
@@ -0,0 +1,69 @@
+package aria2
+
+import (
+	"testing"
+
+	"github.com/hr3lxphr6j/ctfile/aria2/aria2test"
+)
+
+func TestBatch(t *testing.T) {
+	srv := aria2test.NewServer("secret")
+	defer srv.Close()
+	for name, endpoint := range map[string]string{"http": srv.Endpoint(), "websocket": srv.WSEndpoint()} {
+		t.Run(name, func(t *testing.T) {
+			c := New(endpoint, "secret")
+			defer c.Close()
+			gid1 := srv.AddTask(&aria2test.Task{TotalLength: 100})
+			gid2 := srv.AddTask(&aria2test.Task{TotalLength: 200, Status: aria2test.StatusPaused})
+			requests := srv.Requests()
+			results, err := c.Batch().
+				TellStatus(gid1).
+				TellStatus(gid2).
+				Pause(gid1).
+				TellStatus("unknown").
+				AddUri([]string{"http://example.com/a.bin"}, Output("a.bin")).
+				Call("aria2.tellStatus", gid2).
+				Do()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := srv.Requests() - requests; n != 1 {
+				t.Errorf("Do() sends %d requests, want 1", n)
+			}
+			if len(results) != 6 {
+				t.Fatalf("Do() returns %d results, want 6", len(results))
+			}
+			for i, gid := range []string{gid1, gid2} {
+				status, ok := results[i].Value.(*TaskStatus)
+				if results[i].Err != nil || !ok || status.Gid != gid || status.TotalLength != (i+1)*100 {
+					t.Errorf("result %d = %+v, want the status of %s", i, results[i], gid)
+				}
+			}
+			if results[2].Err != nil || results[2].Value != nil {
+				t.Errorf("result of Pause = %+v", results[2])
+			}
+			if task, _ := srv.Task(gid1); task.Status != aria2test.StatusPaused {
+				t.Errorf("status after Pause = %s", task.Status)
+			}
+			if rpcErr, ok := results[3].Err.(*Error); !ok || rpcErr.Code != 1 {
+				t.Errorf("result of the unknown gid = %+v, want *Error", results[3])
+			}
+			if gid, ok := results[4].Value.(string); results[4].Err != nil || !ok {
+				t.Errorf("result of AddUri = %+v", results[4])
+			} else if task, _ := srv.Task(gid); task.Options["out"] != "a.bin" {
+				t.Errorf("options of the added task = %v", task.Options)
+			}
+			if m, ok := results[5].Value.(map[string]interface{}); !ok || m["gid"] != gid2 || results[5].Method != "aria2.tellStatus" {
+				t.Errorf("result of Call = %+v", results[5])
+			}
+
+			results, err = New(endpoint, "wrong").Batch().TellStatus(gid1).Do()
+			if err != nil || len(results) != 1 || results[0].Err == nil || results[0].Err.Error() != "Unauthorized" {
+				t.Errorf("Do() with a wrong secret = %v, %v, want Unauthorized in the results", results, err)
+			}
+			if results, err := c.Batch().Do(); err != nil || results != nil {
+				t.Errorf("Do() of an empty batch = %v, %v", results, err)
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package aria2
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type Status string
@@ -155,36 +160,155 @@ type Peer struct {
 	Seeder bool `json:"seeder,string"`
 }
 
+type Server struct {
+	// Original URI.
+	Uri string `json:"uri"`
+	// This is the URI currently used for downloading. If redirection is involved, currentUri and uri may differ.
+	CurrentUri string `json:"currentUri"`
+	// Download speed (byte/sec)
+	DownloadSpeed int `json:"downloadSpeed,string"`
+}
+
+type FileServers struct {
+	// Index of the file, starting at 1, in the same order as files appear in the multi-file metalink.
+	Index int `json:"index,string"`
+	// A list of servers of the file.
+	Servers []*Server `json:"servers"`
+}
+
+type GlobalStat struct {
+	// Overall download speed (byte/sec).
+	DownloadSpeed int `json:"downloadSpeed,string"`
+	// Overall upload speed(byte/sec).
+	UploadSpeed int `json:"uploadSpeed,string"`
+	// The number of active downloads.
+	NumActive int `json:"numActive,string"`
+	// The number of waiting downloads.
+	NumWaiting int `json:"numWaiting,string"`
+	// The number of stopped downloads in the current session.
+	// This value is capped by the --max-download-result option.
+	NumStopped int `json:"numStopped,string"`
+	// The number of stopped downloads in the current session and not capped by the --max-download-result option.
+	NumStoppedTotal int `json:"numStoppedTotal,string"`
+}
+
+type Version struct {
+	// Version number of aria2 as a string.
+	Version string `json:"version"`
+	// List of enabled features. Each feature is given as a string.
+	EnabledFeatures []string `json:"enabledFeatures"`
+}
+
+type SessionInfo struct {
+	// Session ID, which is generated each time when aria2 is invoked.
+	SessionId string `json:"sessionId"`
+}
+
+// PositionHow is the origin of the position of ChangePosition.
+type PositionHow string
+
+const (
+	// PosSet moves the download to a position relative to the beginning of the queue.
+	PosSet PositionHow = "POS_SET"
+	// PosCur moves the download to a position relative to the current position.
+	PosCur PositionHow = "POS_CUR"
+	// PosEnd moves the download to a position relative to the end of the queue.
+	PosEnd PositionHow = "POS_END"
+)
+
 type Client struct {
-	hc       *http.Client
-	secret   string
-	endpoint string
+	transport transport
+	secret    string
+	hc        *http.Client
+	dialer    *websocket.Dialer
+	timeout   time.Duration
+}
+
+// ClientOption configures the Client created by New.
+type ClientOption func(*Client)
+
+// WithTimeout sets the time limit of every call, zero means no timeout.
+// The calls with a context are limited by both the time limit and the context,
+// and the websocket dials of Subscribe are limited as well.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
 }
 
-func New(endpoint, secret string) *Client {
-	return &Client{
-		hc:       &http.Client{},
-		secret:   secret,
-		endpoint: endpoint,
+// WithHTTPClient sets the http client used by the http transport, the client is copied.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		client := *hc
+		c.hc = &client
 	}
 }
 
-func (c *Client) do(method string, args []interface{}, reply interface{}) error {
+// WithTransport sets the transport of the http client.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.hc.Transport = rt
+	}
+}
+
+// WithTLSConfig sets the tls config of https and wss endpoints.
+// Transport of the http client which is not an *http.Transport will be replaced by a copy of http.DefaultTransport.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		t, ok := c.hc.Transport.(*http.Transport)
+		if !ok || t == nil {
+			t = http.DefaultTransport.(*http.Transport)
+		}
+		t = t.Clone()
+		t.TLSClientConfig = config
+		c.hc.Transport = t
+		c.dialer.TLSClientConfig = config
+	}
+}
+
+// New returns a client of the aria2 rpc endpoint, the websocket transport is used if the scheme of the endpoint
+// is ws or wss, e.g. ws://127.0.0.1:6800/jsonrpc, which is required by Subscribe.
+func New(endpoint, secret string, opts ...ClientOption) *Client {
+	dialer := *websocket.DefaultDialer
+	c := &Client{
+		secret: secret,
+		hc:     &http.Client{},
+		dialer: &dialer,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if strings.HasPrefix(endpoint, "ws://") || strings.HasPrefix(endpoint, "wss://") {
+		c.transport = newWSTransport(endpoint, c.dialer, c.timeout)
+	} else {
+		c.transport = &httpTransport{hc: c.hc, endpoint: endpoint}
+	}
+	return c
+}
+
+// Close closes the websocket connection, it's a no-op for the http transport.
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+// do calls the method with the secret token prepended to the args.
+func (c *Client) do(ctx context.Context, method string, args []interface{}, reply interface{}) error {
 	opts := make([]interface{}, 0, len(args)+2)
 	if c.secret != "" {
 		opts = append(opts, fmt.Sprintf("token:%s", c.secret))
 	}
 	opts = append(opts, args...)
-	b, err := encodeClientRequest(method, opts)
-	if err != nil {
-		return err
-	}
-	resp, err := c.hc.Post(c.endpoint, "application/json", bytes.NewReader(b))
-	if err != nil {
-		return err
+	return c.call(ctx, method, opts, reply)
+}
+
+// call calls the method by the transport with the time limit of the client.
+func (c *Client) call(ctx context.Context, method string, params []interface{}, reply interface{}) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
 	}
-	defer resp.Body.Close()
-	return decodeClientResponse(resp.Body, reply)
+	return c.transport.call(ctx, method, params, reply)
 }
 
 // This method adds a new download. uris is an array of HTTP/FTP/SFTP/BitTorrent URIs (strings) pointing to the same resource.
@@ -192,10 +316,15 @@ func (c *Client) do(method string, args []interface{}, reply interface{}) error
 // When adding BitTorrent Magnet URIs, uris must have only one element and it should be BitTorrent Magnet URI.
 // options is a struct and its members are pairs of option name and value.
 func (c *Client) AddUri(uris []string, options ...option) (string, error) {
+	return c.AddUriContext(context.Background(), uris, options...)
+}
+
+// AddUriContext is like AddUri but with a context.
+func (c *Client) AddUriContext(ctx context.Context, uris []string, options ...option) (string, error) {
 	method := "aria2.addUri"
 	args := []interface{}{uris, newOptions().applyOption(options...)}
 	var gid string
-	if err := c.do(method, args, &gid); err != nil {
+	if err := c.do(ctx, method, args, &gid); err != nil {
 		return "", err
 	}
 	return gid, nil
@@ -208,6 +337,11 @@ func (c *Client) AddUri(uris []string, options ...option) (string, error) {
 // if URI ends with /, name in torrent file is added. For multi-file torrents,
 // name and path in torrent are added to form a URI for each file.
 func (c *Client) AddTorrent(torrent []byte, uris []string, options ...option) (string, error) {
+	return c.AddTorrentContext(context.Background(), torrent, uris, options...)
+}
+
+// AddTorrentContext is like AddTorrent but with a context.
+func (c *Client) AddTorrentContext(ctx context.Context, torrent []byte, uris []string, options ...option) (string, error) {
 	method := "aria2.addTorrent"
 	if uris == nil {
 		uris = []string{}
@@ -218,7 +352,7 @@ func (c *Client) AddTorrent(torrent []byte, uris []string, options ...option) (s
 		newOptions().applyOption(options...),
 	}
 	var gid string
-	if err := c.do(method, args, &gid); err != nil {
+	if err := c.do(ctx, method, args, &gid); err != nil {
 		return "", err
 	}
 	return gid, nil
@@ -226,13 +360,18 @@ func (c *Client) AddTorrent(torrent []byte, uris []string, options ...option) (s
 
 // This method adds a Metalink download by uploading a ".metalink" file.
 func (c *Client) AddMetalink(metalink []byte, options ...option) (string, error) {
+	return c.AddMetalinkContext(context.Background(), metalink, options...)
+}
+
+// AddMetalinkContext is like AddMetalink but with a context.
+func (c *Client) AddMetalinkContext(ctx context.Context, metalink []byte, options ...option) (string, error) {
 	method := "aria2.addMetalink"
 	args := []interface{}{
 		base64.StdEncoding.EncodeToString(metalink),
 		newOptions().applyOption(options...),
 	}
 	var gid string
-	if err := c.do(method, args, &gid); err != nil {
+	if err := c.do(ctx, method, args, &gid); err != nil {
 		return "", err
 	}
 	return gid, nil
@@ -243,9 +382,14 @@ func (c *Client) AddMetalink(metalink []byte, options ...option) (string, error)
 // The status of the removed download becomes removed.
 // This method returns GID of removed download.
 func (c *Client) Remove(gid string) error {
+	return c.RemoveContext(context.Background(), gid)
+}
+
+// RemoveContext is like Remove but with a context.
+func (c *Client) RemoveContext(ctx context.Context, gid string) error {
 	method := "aria2.remove"
 	var s string
-	return c.do(method, []interface{}{gid}, &s)
+	return c.do(ctx, method, []interface{}{gid}, &s)
 }
 
 // This method removes the download denoted by gid.
@@ -253,9 +397,14 @@ func (c *Client) Remove(gid string) error {
 // the download without performing any actions which take time,
 // such as contacting BitTorrent trackers to unregister the download first.
 func (c *Client) ForceRemove(gid string) error {
+	return c.ForceRemoveContext(context.Background(), gid)
+}
+
+// ForceRemoveContext is like ForceRemove but with a context.
+func (c *Client) ForceRemoveContext(ctx context.Context, gid string) error {
 	method := "aria2.forceRemove"
 	var s string
-	return c.do(method, []interface{}{gid}, &s)
+	return c.do(ctx, method, []interface{}{gid}, &s)
 }
 
 // This method pauses the download denoted by gid (string).
@@ -264,16 +413,26 @@ func (c *Client) ForceRemove(gid string) error {
 // While the status is paused, the download is not started.
 // To change status to waiting, use the Unpause() method.
 func (c *Client) Pause(gid string) error {
+	return c.PauseContext(context.Background(), gid)
+}
+
+// PauseContext is like Pause but with a context.
+func (c *Client) PauseContext(ctx context.Context, gid string) error {
 	method := "aria2.pause"
 	var s string
-	return c.do(method, []interface{}{gid}, &s)
+	return c.do(ctx, method, []interface{}{gid}, &s)
 }
 
 // This method is equal to calling aria2.pause() for every active/waiting download.
 func (c *Client) PauseAll() error {
+	return c.PauseAllContext(context.Background())
+}
+
+// PauseAllContext is like PauseAll but with a context.
+func (c *Client) PauseAllContext(ctx context.Context) error {
 	method := "aria2.pauseAll"
 	var s string
-	return c.do(method, nil, &s)
+	return c.do(ctx, method, nil, &s)
 }
 
 // This method pauses the download denoted by gid.
@@ -281,38 +440,75 @@ func (c *Client) PauseAll() error {
 // downloads without performing any actions which take time,
 // such as contacting BitTorrent trackers to unregister the download first.
 func (c *Client) ForcePause(gid string) error {
+	return c.ForcePauseContext(context.Background(), gid)
+}
+
+// ForcePauseContext is like ForcePause but with a context.
+func (c *Client) ForcePauseContext(ctx context.Context, gid string) error {
 	method := "aria2.forcePause"
 	var s string
-	return c.do(method, []interface{}{gid}, &s)
+	return c.do(ctx, method, []interface{}{gid}, &s)
 }
 
 // This method is equal to calling aria2.forcePause() for every active/waiting download.
 func (c *Client) ForcePauseAll() error {
+	return c.ForcePauseAllContext(context.Background())
+}
+
+// ForcePauseAllContext is like ForcePauseAll but with a context.
+func (c *Client) ForcePauseAllContext(ctx context.Context) error {
 	method := "aria2.forcePauseAll"
 	var s string
-	return c.do(method, nil, &s)
+	return c.do(ctx, method, nil, &s)
 }
 
 // This method changes the status of the download denoted by gid (string)
 // from paused to waiting, making the download eligible to be restarted.
 func (c *Client) Unpause(gid string) error {
+	return c.UnpauseContext(context.Background(), gid)
+}
+
+// UnpauseContext is like Unpause but with a context.
+func (c *Client) UnpauseContext(ctx context.Context, gid string) error {
 	method := "aria2.unpause"
 	var s string
-	return c.do(method, []interface{}{gid}, &s)
+	return c.do(ctx, method, []interface{}{gid}, &s)
 }
 
 // This method is equal to calling aria2.unpause() for every paused download.
 func (c *Client) UnpauseAll() error {
+	return c.UnpauseAllContext(context.Background())
+}
+
+// UnpauseAllContext is like UnpauseAll but with a context.
+func (c *Client) UnpauseAllContext(ctx context.Context) error {
 	method := "aria2.unpauseAll"
 	var s string
-	return c.do(method, nil, &s)
+	return c.do(ctx, method, nil, &s)
+}
+
+// withKeys appends the keys to the args if it's not empty.
+func withKeys(args []interface{}, keys []string) []interface{} {
+	if len(keys) > 0 {
+		args = append(args, keys)
+	}
+	return args
 }
 
 // This method returns the progress of the download denoted by gid (string).
-func (c *Client) TellStatus(gid string) (*TaskStatus, error) {
+// keys is an array of strings. If specified, the response contains only keys in the keys array.
+// If keys is empty or omitted, the response contains all keys.
+// This is useful when you just want specific keys and avoid unnecessary transfers.
+// For example, TellStatus("2089b05ecca3d829", "gid", "status") returns the gid and status keys only.
+func (c *Client) TellStatus(gid string, keys ...string) (*TaskStatus, error) {
+	return c.TellStatusContext(context.Background(), gid, keys...)
+}
+
+// TellStatusContext is like TellStatus but with a context.
+func (c *Client) TellStatusContext(ctx context.Context, gid string, keys ...string) (*TaskStatus, error) {
 	method := "aria2.tellStatus"
 	taskStatus := new(TaskStatus)
-	if err := c.do(method, []interface{}{gid}, taskStatus); err != nil {
+	if err := c.do(ctx, method, withKeys([]interface{}{gid}, keys), taskStatus); err != nil {
 		return nil, err
 	}
 	return taskStatus, nil
@@ -320,9 +516,14 @@ func (c *Client) TellStatus(gid string) (*TaskStatus, error) {
 
 // This method returns the URIs used in the download denoted by gid.
 func (c *Client) GetUris(gid string) ([]*Uri, error) {
+	return c.GetUrisContext(context.Background(), gid)
+}
+
+// GetUrisContext is like GetUris but with a context.
+func (c *Client) GetUrisContext(ctx context.Context, gid string) ([]*Uri, error) {
 	method := "aria2.getUris"
 	var uris []*Uri
-	if err := c.do(method, []interface{}{gid}, &uris); err != nil {
+	if err := c.do(ctx, method, []interface{}{gid}, &uris); err != nil {
 		return nil, err
 	}
 	return uris, nil
@@ -330,9 +531,14 @@ func (c *Client) GetUris(gid string) ([]*Uri, error) {
 
 // This method returns the file list of the download denoted by gid.
 func (c *Client) GetFiles(gid string) ([]*File, error) {
+	return c.GetFilesContext(context.Background(), gid)
+}
+
+// GetFilesContext is like GetFiles but with a context.
+func (c *Client) GetFilesContext(ctx context.Context, gid string) ([]*File, error) {
 	method := "aria2.getFiles"
 	var files []*File
-	if err := c.do(method, []interface{}{gid}, &files); err != nil {
+	if err := c.do(ctx, method, []interface{}{gid}, &files); err != nil {
 		return nil, err
 	}
 	return files, nil
@@ -340,10 +546,338 @@ func (c *Client) GetFiles(gid string) ([]*File, error) {
 
 // This method returns a list peers of the download denoted by gid (string). This method is for BitTorrent only.
 func (c *Client) GetPeers(gid string) ([]*Peer, error) {
+	return c.GetPeersContext(context.Background(), gid)
+}
+
+// GetPeersContext is like GetPeers but with a context.
+func (c *Client) GetPeersContext(ctx context.Context, gid string) ([]*Peer, error) {
 	method := "aria2.getPeers"
 	var peers []*Peer
-	if err := c.do(method, []interface{}{gid}, &peers); err != nil {
+	if err := c.do(ctx, method, []interface{}{gid}, &peers); err != nil {
 		return nil, err
 	}
 	return peers, nil
 }
+
+// This method returns currently connected HTTP(S)/FTP/SFTP servers of the download denoted by gid (string).
+func (c *Client) GetServers(gid string) ([]*FileServers, error) {
+	return c.GetServersContext(context.Background(), gid)
+}
+
+// GetServersContext is like GetServers but with a context.
+func (c *Client) GetServersContext(ctx context.Context, gid string) ([]*FileServers, error) {
+	method := "aria2.getServers"
+	var servers []*FileServers
+	if err := c.do(ctx, method, []interface{}{gid}, &servers); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// This method returns a list of active downloads.
+// The response is an array of the same structs as returned by the TellStatus() method.
+// For the keys parameter, please refer to the TellStatus() method.
+func (c *Client) TellActive(keys ...string) ([]*TaskStatus, error) {
+	return c.TellActiveContext(context.Background(), keys...)
+}
+
+// TellActiveContext is like TellActive but with a context.
+func (c *Client) TellActiveContext(ctx context.Context, keys ...string) ([]*TaskStatus, error) {
+	method := "aria2.tellActive"
+	var tasks []*TaskStatus
+	if err := c.do(ctx, method, withKeys(nil, keys), &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// This method returns a list of waiting downloads, including paused ones.
+// offset is an integer and specifies the offset from the download waiting at the front.
+// num is an integer and specifies the max. number of downloads to be returned.
+// For the keys parameter, please refer to the TellStatus() method.
+// If offset is a positive integer, this method returns downloads in the range of [offset, offset + num).
+// offset can be a negative integer. offset == -1 points last download in the waiting queue and offset == -2
+// points the download before the last download, and so on. Downloads in the response are in reversed order then.
+func (c *Client) TellWaiting(offset, num int, keys ...string) ([]*TaskStatus, error) {
+	return c.TellWaitingContext(context.Background(), offset, num, keys...)
+}
+
+// TellWaitingContext is like TellWaiting but with a context.
+func (c *Client) TellWaitingContext(ctx context.Context, offset, num int, keys ...string) ([]*TaskStatus, error) {
+	method := "aria2.tellWaiting"
+	var tasks []*TaskStatus
+	if err := c.do(ctx, method, withKeys([]interface{}{offset, num}, keys), &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// This method returns a list of stopped downloads.
+// offset is an integer and specifies the offset from the least recently stopped download.
+// num is an integer and specifies the max. number of downloads to be returned.
+// For the keys parameter, please refer to the TellStatus() method.
+// offset and num have the same semantics as described in the TellWaiting() method.
+func (c *Client) TellStopped(offset, num int, keys ...string) ([]*TaskStatus, error) {
+	return c.TellStoppedContext(context.Background(), offset, num, keys...)
+}
+
+// TellStoppedContext is like TellStopped but with a context.
+func (c *Client) TellStoppedContext(ctx context.Context, offset, num int, keys ...string) ([]*TaskStatus, error) {
+	method := "aria2.tellStopped"
+	var tasks []*TaskStatus
+	if err := c.do(ctx, method, withKeys([]interface{}{offset, num}, keys), &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// This method changes the position of the download denoted by gid in the queue.
+// If how is PosSet, it moves the download to a position relative to the beginning of the queue.
+// If how is PosCur, it moves the download to a position relative to the current position.
+// If how is PosEnd, it moves the download to a position relative to the end of the queue.
+// If the destination position is less than 0 or beyond the end of the queue,
+// it moves the download to the beginning or the end of the queue respectively.
+// The response is an integer denoting the resulting position.
+func (c *Client) ChangePosition(gid string, pos int, how PositionHow) (int, error) {
+	return c.ChangePositionContext(context.Background(), gid, pos, how)
+}
+
+// ChangePositionContext is like ChangePosition but with a context.
+func (c *Client) ChangePositionContext(ctx context.Context, gid string, pos int, how PositionHow) (int, error) {
+	method := "aria2.changePosition"
+	var position int
+	if err := c.do(ctx, method, []interface{}{gid, pos, how}, &position); err != nil {
+		return 0, err
+	}
+	return position, nil
+}
+
+// This method removes the URIs in delUris from and appends the URIs in addUris to download denoted by gid.
+// A download can contain multiple files and URIs are attached to each file.
+// fileIndex is used to select which file to remove/attach given URIs. fileIndex is 1-based.
+// position is used to specify where URIs are inserted in the existing waiting URI list, it's 0-based.
+// When position is negative, URIs are appended to the back of the list.
+// This method first executes the removal and then the addition.
+// This method returns the number of URIs deleted and the number of URIs added.
+func (c *Client) ChangeUri(gid string, fileIndex int, delUris, addUris []string, position int) (deleted, added int, err error) {
+	return c.ChangeUriContext(context.Background(), gid, fileIndex, delUris, addUris, position)
+}
+
+// ChangeUriContext is like ChangeUri but with a context.
+func (c *Client) ChangeUriContext(ctx context.Context, gid string, fileIndex int, delUris, addUris []string, position int) (deleted, added int, err error) {
+	method := "aria2.changeUri"
+	if delUris == nil {
+		delUris = []string{}
+	}
+	if addUris == nil {
+		addUris = []string{}
+	}
+	args := []interface{}{gid, fileIndex, delUris, addUris}
+	if position >= 0 {
+		args = append(args, position)
+	}
+	var counts []int
+	if err := c.do(ctx, method, args, &counts); err != nil {
+		return 0, 0, err
+	}
+	if len(counts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected result of %s: %v", method, counts)
+	}
+	return counts[0], counts[1], nil
+}
+
+// This method returns options of the download denoted by gid.
+// Note that this method does not return options which have no default value and have not been set on the command-line,
+// in configuration files or RPC methods.
+func (c *Client) GetOption(gid string) (map[string]string, error) {
+	return c.GetOptionContext(context.Background(), gid)
+}
+
+// GetOptionContext is like GetOption but with a context.
+func (c *Client) GetOptionContext(ctx context.Context, gid string) (map[string]string, error) {
+	method := "aria2.getOption"
+	var options map[string]string
+	if err := c.do(ctx, method, []interface{}{gid}, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// This method changes options of the download denoted by gid (string) dynamically.
+func (c *Client) ChangeOption(gid string, options ...option) error {
+	return c.ChangeOptionContext(context.Background(), gid, options...)
+}
+
+// ChangeOptionContext is like ChangeOption but with a context.
+func (c *Client) ChangeOptionContext(ctx context.Context, gid string, options ...option) error {
+	method := "aria2.changeOption"
+	var s string
+	return c.do(ctx, method, []interface{}{gid, newOptions().applyOption(options...)}, &s)
+}
+
+// This method returns the global options.
+// Note that this method does not return options which have no default value and have not been set on the command-line,
+// in configuration files or RPC methods.
+func (c *Client) GetGlobalOption() (map[string]string, error) {
+	return c.GetGlobalOptionContext(context.Background())
+}
+
+// GetGlobalOptionContext is like GetGlobalOption but with a context.
+func (c *Client) GetGlobalOptionContext(ctx context.Context) (map[string]string, error) {
+	method := "aria2.getGlobalOption"
+	var options map[string]string
+	if err := c.do(ctx, method, nil, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// This method changes global options dynamically.
+func (c *Client) ChangeGlobalOption(options ...option) error {
+	return c.ChangeGlobalOptionContext(context.Background(), options...)
+}
+
+// ChangeGlobalOptionContext is like ChangeGlobalOption but with a context.
+func (c *Client) ChangeGlobalOptionContext(ctx context.Context, options ...option) error {
+	method := "aria2.changeGlobalOption"
+	var s string
+	return c.do(ctx, method, []interface{}{newOptions().applyOption(options...)}, &s)
+}
+
+// This method returns global statistics such as the overall download and upload speeds.
+func (c *Client) GetGlobalStat() (*GlobalStat, error) {
+	return c.GetGlobalStatContext(context.Background())
+}
+
+// GetGlobalStatContext is like GetGlobalStat but with a context.
+func (c *Client) GetGlobalStatContext(ctx context.Context) (*GlobalStat, error) {
+	method := "aria2.getGlobalStat"
+	stat := new(GlobalStat)
+	if err := c.do(ctx, method, nil, stat); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// This method purges completed/error/removed downloads to free memory.
+func (c *Client) PurgeDownloadResult() error {
+	return c.PurgeDownloadResultContext(context.Background())
+}
+
+// PurgeDownloadResultContext is like PurgeDownloadResult but with a context.
+func (c *Client) PurgeDownloadResultContext(ctx context.Context) error {
+	method := "aria2.purgeDownloadResult"
+	var s string
+	return c.do(ctx, method, nil, &s)
+}
+
+// This method removes a completed/error/removed download denoted by gid from memory.
+func (c *Client) RemoveDownloadResult(gid string) error {
+	return c.RemoveDownloadResultContext(context.Background(), gid)
+}
+
+// RemoveDownloadResultContext is like RemoveDownloadResult but with a context.
+func (c *Client) RemoveDownloadResultContext(ctx context.Context, gid string) error {
+	method := "aria2.removeDownloadResult"
+	var s string
+	return c.do(ctx, method, []interface{}{gid}, &s)
+}
+
+// This method returns the version of aria2 and the list of enabled features.
+func (c *Client) GetVersion() (*Version, error) {
+	return c.GetVersionContext(context.Background())
+}
+
+// GetVersionContext is like GetVersion but with a context.
+func (c *Client) GetVersionContext(ctx context.Context) (*Version, error) {
+	method := "aria2.getVersion"
+	version := new(Version)
+	if err := c.do(ctx, method, nil, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// This method returns session information.
+func (c *Client) GetSessionInfo() (*SessionInfo, error) {
+	return c.GetSessionInfoContext(context.Background())
+}
+
+// GetSessionInfoContext is like GetSessionInfo but with a context.
+func (c *Client) GetSessionInfoContext(ctx context.Context) (*SessionInfo, error) {
+	method := "aria2.getSessionInfo"
+	info := new(SessionInfo)
+	if err := c.do(ctx, method, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// This method shuts down aria2.
+func (c *Client) Shutdown() error {
+	return c.ShutdownContext(context.Background())
+}
+
+// ShutdownContext is like Shutdown but with a context.
+func (c *Client) ShutdownContext(ctx context.Context) error {
+	method := "aria2.shutdown"
+	var s string
+	return c.do(ctx, method, nil, &s)
+}
+
+// This method shuts down aria2. This method behaves like Shutdown() without performing any actions which take time,
+// such as contacting BitTorrent trackers to unregister downloads first.
+func (c *Client) ForceShutdown() error {
+	return c.ForceShutdownContext(context.Background())
+}
+
+// ForceShutdownContext is like ForceShutdown but with a context.
+func (c *Client) ForceShutdownContext(ctx context.Context) error {
+	method := "aria2.forceShutdown"
+	var s string
+	return c.do(ctx, method, nil, &s)
+}
+
+// This method saves the current session to a file specified by the --save-session option.
+func (c *Client) SaveSession() error {
+	return c.SaveSessionContext(context.Background())
+}
+
+// SaveSessionContext is like SaveSession but with a context.
+func (c *Client) SaveSessionContext(ctx context.Context) error {
+	method := "aria2.saveSession"
+	var s string
+	return c.do(ctx, method, nil, &s)
+}
+
+// This method returns all the available RPC methods in an array of string.
+// Unlike other methods, this method does not require secret token.
+func (c *Client) ListMethods() ([]string, error) {
+	return c.ListMethodsContext(context.Background())
+}
+
+// ListMethodsContext is like ListMethods but with a context.
+func (c *Client) ListMethodsContext(ctx context.Context) ([]string, error) {
+	method := "system.listMethods"
+	var methods []string
+	if err := c.call(ctx, method, nil, &methods); err != nil {
+		return nil, err
+	}
+	return methods, nil
+}
+
+// This method returns all the available RPC notifications in an array of string.
+// Unlike other methods, this method does not require secret token.
+func (c *Client) ListNotifications() ([]string, error) {
+	return c.ListNotificationsContext(context.Background())
+}
+
+// ListNotificationsContext is like ListNotifications but with a context.
+func (c *Client) ListNotificationsContext(ctx context.Context) ([]string, error) {
+	method := "system.listNotifications"
+	var notifications []string
+	if err := c.call(ctx, method, nil, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
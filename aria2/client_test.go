@@ -1 +1,618 @@
 package aria2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hr3lxphr6j/ctfile/aria2/aria2test"
+)
+
+func TestClient(t *testing.T) {
+	srv := aria2test.NewServer("secret")
+	defer srv.Close()
+	for name, endpoint := range map[string]string{"http": srv.Endpoint(), "websocket": srv.WSEndpoint()} {
+		t.Run(name, func(t *testing.T) {
+			c := New(endpoint, "secret")
+			defer c.Close()
+			gid, err := c.AddUri([]string{"http://example.com/a.bin"}, Output("sub/a.bin"), Directory("/data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			task, _ := srv.Task(gid)
+			if task.Options["out"] != "sub/a.bin" || task.Options["dir"] != "/data" {
+				t.Errorf("options of the task = %v", task.Options)
+			}
+			if err := c.Pause(gid); err != nil {
+				t.Fatal(err)
+			}
+			status, err := c.TellStatus(gid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Gid != gid || status.Status != StatusPaused || status.Dir != "/data" || len(status.Files) != 1 {
+				t.Errorf("TellStatus() = %+v", status)
+			}
+			if err := c.Unpause(gid); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Remove(gid); err != nil {
+				t.Fatal(err)
+			}
+			var rpcErr *Error
+			if err := c.Unpause(gid); !errors.As(err, &rpcErr) {
+				t.Errorf("Unpause() of the removed download = %v, want *Error", err)
+			}
+			if _, err := New(endpoint, "wrong").TellStatus(gid); err == nil || err.Error() != "Unauthorized" {
+				t.Errorf("TellStatus() with a wrong secret = %v, want Unauthorized", err)
+			}
+		})
+	}
+}
+
+func TestClient_WebSocket_Concurrent(t *testing.T) {
+	srv := aria2test.NewServer("")
+	defer srv.Close()
+	c := New(srv.WSEndpoint(), "")
+	defer c.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		gid := srv.AddTask(&aria2test.Task{TotalLength: int64(i)})
+		wg.Add(1)
+		go func(i int, gid string) {
+			defer wg.Done()
+			status, err := c.TellStatus(gid)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if status.Gid != gid || status.TotalLength != i {
+				t.Errorf("TellStatus(%s) = %+v, want the status of itself", gid, status)
+			}
+		}(i, gid)
+	}
+	wg.Wait()
+}
+
+// subscribe subscribes the client and returns the channel of notifications.
+func subscribe(t *testing.T, c *Client) <-chan *Notification {
+	t.Helper()
+	ch := make(chan *Notification, 16)
+	if _, err := c.Subscribe(func(n *Notification) {
+		ch <- n
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the round trip makes sure the server is serving the connection, the error is expected.
+	c.TellStatus("")
+	return ch
+}
+
+func nextNotification(t *testing.T, ch <-chan *Notification) *Notification {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification is received")
+		return nil
+	}
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	srv := aria2test.NewServer("")
+	defer srv.Close()
+	if _, err := New(srv.Endpoint(), "").Subscribe(func(*Notification) {}); err != ErrNotificationUnsupported {
+		t.Errorf("Subscribe() over http = %v, want %v", err, ErrNotificationUnsupported)
+	}
+
+	c := New(srv.WSEndpoint(), "")
+	defer c.Close()
+	ch := subscribe(t, c)
+	gid := srv.AddTask(&aria2test.Task{})
+	tests := []struct {
+		status string
+		event  Event
+	}{
+		{aria2test.StatusPaused, EventDownloadPause},
+		{aria2test.StatusActive, EventDownloadStart},
+		{aria2test.StatusComplete, EventDownloadComplete},
+	}
+	for _, test := range tests {
+		srv.SetStatus(gid, test.status, "")
+		if n := nextNotification(t, ch); n.Event != test.event || n.Gid != gid {
+			t.Errorf("notification of %s = %+v, want %s of %s", test.status, n, test.event, gid)
+		}
+	}
+	// the notification is sent before the response of the call.
+	gid, err := c.AddUri([]string{"http://example.com/b.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Pause(gid); err != nil {
+		t.Fatal(err)
+	}
+	if n := nextNotification(t, ch); n.Event != EventDownloadPause || n.Gid != gid {
+		t.Errorf("notification of Pause() = %+v", n)
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	srv := aria2test.NewServer("")
+	defer srv.Close()
+	c := New(srv.WSEndpoint(), "")
+	defer c.Close()
+	ch := subscribe(t, c)
+	srv.DropConnections()
+	if n := nextNotification(t, ch); n.Event != EventReconnected {
+		t.Fatalf("notification after the connection is dropped = %+v, want %s", n, EventReconnected)
+	}
+	gid := srv.AddTask(&aria2test.Task{})
+	// the round trip makes sure the server is serving the new connection.
+	if _, err := c.TellStatus(gid); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetStatus(gid, aria2test.StatusError, "boom")
+	if n := nextNotification(t, ch); n.Event != EventDownloadError || n.Gid != gid {
+		t.Errorf("notification after reconnected = %+v", n)
+	}
+	status, err := c.TellStatus(gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != StatusError || status.ErrorMessage != "boom" {
+		t.Errorf("TellStatus() = %+v", status)
+	}
+
+	c.Close()
+	if _, err := c.TellStatus(gid); err != ErrConnectionClosed {
+		t.Errorf("TellStatus() after Close() = %v, want %v", err, ErrConnectionClosed)
+	}
+}
+
+func gids(tasks []*TaskStatus) []string {
+	var gids []string
+	for _, task := range tasks {
+		gids = append(gids, task.Gid)
+	}
+	return gids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClient_Tell(t *testing.T) {
+	srv := aria2test.NewServer("secret")
+	defer srv.Close()
+	c := New(srv.Endpoint(), "secret")
+	active := srv.AddTask(&aria2test.Task{TotalLength: 10})
+	w1 := srv.AddTask(&aria2test.Task{Status: aria2test.StatusWaiting})
+	w2 := srv.AddTask(&aria2test.Task{Status: aria2test.StatusPaused})
+	w3 := srv.AddTask(&aria2test.Task{Status: aria2test.StatusWaiting})
+	s1 := srv.AddTask(&aria2test.Task{})
+	s2 := srv.AddTask(&aria2test.Task{})
+	srv.SetStatus(s1, aria2test.StatusComplete, "")
+	srv.SetStatus(s2, aria2test.StatusError, "boom")
+
+	tasks, err := c.TellActive("gid", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Gid != active || tasks[0].Status != StatusActive || tasks[0].TotalLength != 0 {
+		t.Errorf("TellActive() with keys = %+v, want the gid and status of %s only", tasks, active)
+	}
+	status, err := c.TellStatus(active, "totalLength")
+	if err != nil || status.Gid != "" || status.TotalLength != 10 {
+		t.Errorf("TellStatus() with keys = %+v, %v, want the totalLength only", status, err)
+	}
+
+	tests := []struct {
+		name        string
+		tell        func(offset, num int, keys ...string) ([]*TaskStatus, error)
+		offset, num int
+		want        []string
+	}{
+		{"TellWaiting", c.TellWaiting, 0, 10, []string{w1, w2, w3}},
+		{"TellWaiting", c.TellWaiting, 1, 1, []string{w2}},
+		{"TellWaiting", c.TellWaiting, -1, 2, []string{w3, w2}},
+		{"TellStopped", c.TellStopped, 0, 10, []string{s1, s2}},
+		{"TellStopped", c.TellStopped, -1, 10, []string{s2, s1}},
+	}
+	for _, test := range tests {
+		tasks, err := test.tell(test.offset, test.num)
+		if err != nil {
+			t.Errorf("%s(%d, %d) = %v", test.name, test.offset, test.num, err)
+			continue
+		}
+		if got := gids(tasks); !equalStrings(got, test.want) {
+			t.Errorf("%s(%d, %d) = %v, want %v", test.name, test.offset, test.num, got, test.want)
+		}
+	}
+
+	moves := []struct {
+		pos  int
+		how  PositionHow
+		want int
+		gids []string
+	}{
+		{0, PosSet, 0, []string{w3, w1, w2}},
+		{1, PosCur, 1, []string{w1, w3, w2}},
+		{0, PosEnd, 2, []string{w1, w2, w3}},
+		{-10, PosCur, 0, []string{w3, w1, w2}},
+	}
+	for _, move := range moves {
+		pos, err := c.ChangePosition(w3, move.pos, move.how)
+		if err != nil || pos != move.want {
+			t.Errorf("ChangePosition(%d, %s) = %d, %v, want %d", move.pos, move.how, pos, err, move.want)
+		}
+		if tasks, _ := c.TellWaiting(0, 10); !equalStrings(gids(tasks), move.gids) {
+			t.Errorf("waiting queue after ChangePosition(%d, %s) = %v, want %v", move.pos, move.how, gids(tasks), move.gids)
+		}
+	}
+
+	stat, err := c.GetGlobalStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.NumActive != 1 || stat.NumWaiting != 3 || stat.NumStopped != 2 {
+		t.Errorf("GetGlobalStat() = %+v", stat)
+	}
+	if err := c.RemoveDownloadResult(active); err == nil {
+		t.Error("RemoveDownloadResult() of an active download succeeded")
+	}
+	if err := c.RemoveDownloadResult(s1); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := c.TellStopped(0, 10); !equalStrings(gids(tasks), []string{s2}) {
+		t.Errorf("stopped downloads after RemoveDownloadResult() = %v", gids(tasks))
+	}
+	if err := c.PurgeDownloadResult(); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := c.TellStopped(0, 10); len(tasks) != 0 {
+		t.Errorf("stopped downloads after PurgeDownloadResult() = %v", gids(tasks))
+	}
+}
+
+func TestClient_Uris(t *testing.T) {
+	srv := aria2test.NewServer("")
+	defer srv.Close()
+	c := New(srv.Endpoint(), "")
+	gid := srv.AddTask(&aria2test.Task{Uris: []string{"http://a/f", "http://b/f"}})
+
+	servers, err := c.GetServers(gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Index != 1 || len(servers[0].Servers) != 2 || servers[0].Servers[1].Uri != "http://b/f" {
+		t.Errorf("GetServers() = %+v", servers)
+	}
+	deleted, added, err := c.ChangeUri(gid, 1, []string{"http://a/f"}, []string{"http://c/f", "http://d/f"}, 0)
+	if err != nil || deleted != 1 || added != 2 {
+		t.Errorf("ChangeUri() = %d, %d, %v, want 1, 2", deleted, added, err)
+	}
+	uris, err := c.GetUris(gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, uri := range uris {
+		got = append(got, uri.Uri)
+	}
+	if want := []string{"http://c/f", "http://d/f", "http://b/f"}; !equalStrings(got, want) {
+		t.Errorf("uris after ChangeUri() = %v, want %v", got, want)
+	}
+	if _, _, err := c.ChangeUri(gid, 1, nil, []string{"http://e/f"}, -1); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := c.GetFiles(gid); err != nil || len(files) != 1 || len(files[0].Uris) != 4 || files[0].Uris[3].Uri != "http://e/f" {
+		t.Errorf("GetFiles() after appending an uri = %+v, %v", files, err)
+	}
+}
+
+func TestClient_Options(t *testing.T) {
+	srv := aria2test.NewServer("secret")
+	defer srv.Close()
+	c := New(srv.Endpoint(), "secret")
+	gid, err := c.AddUri([]string{"http://example.com/a"}, Output("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangeOption(gid, Custom("max-download-limit", "1M")); err != nil {
+		t.Fatal(err)
+	}
+	options, err := c.GetOption(gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options["out"] != "a" || options["max-download-limit"] != "1M" || options["dir"] != "/downloads" {
+		t.Errorf("GetOption() = %v", options)
+	}
+	if err := c.ChangeGlobalOption(Custom("max-concurrent-downloads", "10")); err != nil {
+		t.Fatal(err)
+	}
+	global, err := c.GetGlobalOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if global["max-concurrent-downloads"] != "10" || global["dir"] != "/downloads" {
+		t.Errorf("GetGlobalOption() = %v", global)
+	}
+}
+
+func TestClient_System(t *testing.T) {
+	srv := aria2test.NewServer("secret")
+	defer srv.Close()
+	c := New(srv.Endpoint(), "secret")
+
+	version, err := c.GetVersion()
+	if err != nil || version.Version != aria2test.Version || len(version.EnabledFeatures) == 0 {
+		t.Errorf("GetVersion() = %+v, %v", version, err)
+	}
+	info, err := c.GetSessionInfo()
+	if err != nil || info.SessionId != aria2test.SessionID {
+		t.Errorf("GetSessionInfo() = %+v, %v", info, err)
+	}
+	if err := c.SaveSession(); err != nil || srv.SavedSessions() != 1 {
+		t.Errorf("SaveSession() = %v, saved %d sessions", err, srv.SavedSessions())
+	}
+
+	// system.list* do not require the token.
+	anonymous := New(srv.Endpoint(), "")
+	methods, err := anonymous.ListMethods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, method := range methods {
+		found[method] = true
+	}
+	for _, method := range []string{"aria2.addUri", "aria2.tellWaiting", "aria2.getGlobalStat", "system.multicall"} {
+		if !found[method] {
+			t.Errorf("ListMethods() = %v, want %s in it", methods, method)
+		}
+	}
+	notifications, err := anonymous.ListNotifications()
+	if err != nil || len(notifications) != 6 || notifications[0] != string(EventDownloadStart) {
+		t.Errorf("ListNotifications() = %v, %v", notifications, err)
+	}
+
+	if err := c.Shutdown(); err != nil || srv.ShutdownMethod() != "aria2.shutdown" {
+		t.Errorf("Shutdown() = %v, server is shut down by %q", err, srv.ShutdownMethod())
+	}
+	if err := c.ForceShutdown(); err != nil || srv.ShutdownMethod() != "aria2.forceShutdown" {
+		t.Errorf("ForceShutdown() = %v, server is shut down by %q", err, srv.ShutdownMethod())
+	}
+}
+
+// hangingServer accepts the requests of both transports and never responds.
+func hangingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestClient_Context(t *testing.T) {
+	srv := hangingServer(t)
+	endpoints := map[string]string{"http": srv.URL + "/jsonrpc", "websocket": "ws" + strings.TrimPrefix(srv.URL, "http") + "/jsonrpc"}
+	for name, endpoint := range endpoints {
+		t.Run(name, func(t *testing.T) {
+			c := New(endpoint, "", WithTimeout(50*time.Millisecond))
+			defer c.Close()
+			if _, err := c.TellStatus("2089b05ecca3d829"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("TellStatus() with a timeout = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if _, err := c.Batch().TellStatus("2089b05ecca3d829").Do(); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Do() with a timeout = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			c = New(endpoint, "")
+			defer c.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			if _, err := c.GetVersionContext(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("GetVersionContext() with a canceled context = %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
+
+func TestClient_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	var httpErr *HTTPError
+	if _, err := New(srv.URL, "").GetVersion(); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("GetVersion() = %v, want *HTTPError of %d", err, http.StatusBadGateway)
+	}
+
+	// aria2 responds the errors of the rpc with http status 400.
+	aria2 := aria2test.NewServer("secret")
+	defer aria2.Close()
+	var rpcErr *Error
+	if _, err := New(aria2.Endpoint(), "wrong").GetVersion(); !errors.As(err, &rpcErr) || rpcErr.Message != "Unauthorized" {
+		t.Errorf("GetVersion() with a wrong secret = %v, want *Error", err)
+	}
+}
+
+func TestClient_TLS(t *testing.T) {
+	aria2 := aria2test.NewServer("")
+	defer aria2.Close()
+	srv := httptest.NewTLSServer(aria2.Config.Handler)
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	endpoints := map[string]string{"http": srv.URL + "/jsonrpc", "websocket": "wss" + strings.TrimPrefix(srv.URL, "https") + "/jsonrpc"}
+	for name, endpoint := range endpoints {
+		t.Run(name, func(t *testing.T) {
+			c := New(endpoint, "")
+			if _, err := c.GetVersion(); err == nil {
+				t.Error("GetVersion() of an untrusted certificate succeeds")
+			}
+			c.Close()
+
+			c = New(endpoint, "", WithTLSConfig(&tls.Config{RootCAs: pool}))
+			defer c.Close()
+			if version, err := c.GetVersion(); err != nil || version.Version != aria2test.Version {
+				t.Errorf("GetVersion() with the tls config = %+v, %v", version, err)
+			}
+		})
+	}
+	if _, err := New(srv.URL, "", WithHTTPClient(srv.Client())).GetVersion(); err != nil {
+		t.Errorf("GetVersion() with the http client = %v", err)
+	}
+}
+
+func TestClient_Reconnect_HalfOpen(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		dials int
+		conns []*websocket.Conn
+	)
+	upgrader := websocket.Upgrader{}
+	// the server never reads, so the pings are never answered like a half-open connection.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		dials++
+		conns = append(conns, conn)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	c := New("ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	defer c.Close()
+	c.transport.(*wsTransport).pingInterval = 20 * time.Millisecond
+	ch := make(chan *Notification, 16)
+	if _, err := c.Subscribe(func(n *Notification) {
+		ch <- n
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := nextNotification(t, ch); n.Event != EventReconnected {
+		t.Fatalf("notification after the connection is lost = %+v, want %s", n, EventReconnected)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if dials < 2 {
+		t.Errorf("dials = %d, want at least 2", dials)
+	}
+}
+
+func TestClient_Subscribe_Timeout(t *testing.T) {
+	// the listener accepts the connections but never responds the handshake.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c := New("ws"+strings.TrimPrefix(srv.URL, "http"), "", WithTimeout(50*time.Millisecond))
+	defer c.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Subscribe(func(*Notification) {})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Subscribe() = nil, want an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe() is not limited by WithTimeout")
+	}
+}
+
+func TestClient_SlowDial(t *testing.T) {
+	// the listener accepts the connections but never responds the handshake.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c := New("ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	tr := c.transport.(*wsTransport)
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := c.Subscribe(func(*Notification) {})
+		subscribed <- err
+	}()
+	for dialing := false; !dialing; {
+		time.Sleep(time.Millisecond)
+		tr.mu.Lock()
+		dialing = tr.dialing != nil
+		tr.mu.Unlock()
+	}
+
+	// the dial in progress blocks neither the calls with a context nor Close.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.TellStatusContext(ctx, "gid"); err != context.DeadlineExceeded {
+		t.Errorf("TellStatusContext() while dialing = %v, want %v", err, context.DeadlineExceeded)
+	}
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close() is blocked by the dial")
+	}
+	select {
+	case err := <-subscribed:
+		if err == nil {
+			t.Error("Subscribe() aborted by Close() = nil, want an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dial is not aborted by Close()")
+	}
+}
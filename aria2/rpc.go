@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
 )
 
 type Error struct {
@@ -16,6 +15,15 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
+// HTTPError is returned when the endpoint responds an unexpected http status without an error of the rpc.
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("StatusCode: %d", e.StatusCode)
+}
+
 // ----------------------------------------------------------------------------
 // Request and Response
 // ----------------------------------------------------------------------------
@@ -39,11 +47,11 @@ type clientResponse struct {
 }
 
 // encodeClientRequest encodes parameters for a JSON-RPC client request.
-func encodeClientRequest(method string, args interface{}) ([]byte, error) {
+func encodeClientRequest(id uint64, method string, args interface{}) ([]byte, error) {
 	c := &clientRequest{
 		Method: method,
 		Params: args,
-		Id:     uint64(rand.Int63()),
+		Id:     id,
 	}
 	return json.Marshal(c)
 }
@@ -55,6 +63,11 @@ func decodeClientResponse(r io.Reader, reply interface{}) error {
 	if err := json.NewDecoder(r).Decode(&c); err != nil {
 		return err
 	}
+	return c.decode(reply)
+}
+
+// decode decodes the result into the interface reply, or returns the error of the response.
+func (c *clientResponse) decode(reply interface{}) error {
 	if c.Error != nil {
 		return c.Error
 	}
@@ -0,0 +1,65 @@
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+)
+
+// maxErrorBody is the max size of the body of a non-200 response to read.
+const maxErrorBody = 64 << 10
+
+// transport sends the json-rpc requests to aria2.
+type transport interface {
+	call(ctx context.Context, method string, params []interface{}, reply interface{}) error
+	close() error
+}
+
+// httpTransport sends every request by a http POST.
+type httpTransport struct {
+	hc       *http.Client
+	endpoint string
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params []interface{}, reply interface{}) error {
+	b, err := encodeClientRequest(uint64(rand.Int63()), method, params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeErrorResponse(resp)
+	}
+	return decodeClientResponse(resp.Body, reply)
+}
+
+// decodeErrorResponse returns the error of a non-200 response.
+// aria2 responds the errors of the rpc with http status 400, the *Error in the body is returned for it,
+// otherwise the response is not from aria2, e.g. a reverse proxy, and an *HTTPError is returned.
+func decodeErrorResponse(resp *http.Response) error {
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err == nil {
+		var c clientResponse
+		if err := json.Unmarshal(b, &c); err == nil && c.Error != nil {
+			return c.Error
+		}
+	}
+	return &HTTPError{StatusCode: resp.StatusCode}
+}
+
+func (t *httpTransport) close() error {
+	return nil
+}
@@ -0,0 +1,422 @@
+package aria2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/gorilla/websocket"
+)
+
+// Event is the method name of a notification.
+type Event string
+
+const (
+	// EventDownloadStart is sent when a download is started.
+	EventDownloadStart Event = "aria2.onDownloadStart"
+	// EventDownloadPause is sent when a download is paused.
+	EventDownloadPause Event = "aria2.onDownloadPause"
+	// EventDownloadStop is sent when a download is stopped by the user.
+	EventDownloadStop Event = "aria2.onDownloadStop"
+	// EventDownloadComplete is sent when a download is complete.
+	// For BitTorrent downloads, it's sent when the download is complete and seeding is over.
+	EventDownloadComplete Event = "aria2.onDownloadComplete"
+	// EventDownloadError is sent when a download is stopped due to an error.
+	EventDownloadError Event = "aria2.onDownloadError"
+	// EventBtDownloadComplete is sent when a torrent download is complete but seeding is still going on.
+	EventBtDownloadComplete Event = "aria2.onBtDownloadComplete"
+	// EventReconnected is not sent by aria2, but after the websocket connection is re-established,
+	// the notifications while disconnected are lost, so the states of downloads should be refreshed.
+	EventReconnected Event = "reconnected"
+)
+
+// Notification is a notification of aria2.
+type Notification struct {
+	Event Event
+	// Gid is the download of the event, it's empty for EventReconnected.
+	Gid string
+}
+
+var (
+	// ErrNotificationUnsupported is returned by Subscribe if the client does not use the websocket transport.
+	ErrNotificationUnsupported = errors.New("notifications require a websocket endpoint")
+	// ErrConnectionClosed is returned by the pending calls if the websocket connection is closed.
+	ErrConnectionClosed = errors.New("websocket connection is closed")
+)
+
+// pingInterval is the interval of the pings to detect a broken connection, the connection is
+// treated as broken if nothing is received in two intervals.
+const pingInterval = 30 * time.Second
+
+// Subscribe calls the handler with every notification of aria2 until the returned function is called.
+// The connection is established by Subscribe, and re-established automatically if it's broken,
+// a connection which is silently lost is detected by the pings.
+//
+// The handler is called in the goroutine reading the connection, so it must not block,
+// especially not call the methods of the client.
+func (c *Client) Subscribe(handler func(n *Notification)) (unsubscribe func(), err error) {
+	t, ok := c.transport.(*wsTransport)
+	if !ok {
+		return nil, ErrNotificationUnsupported
+	}
+	return t.subscribe(handler)
+}
+
+// wsTransport multiplexes the requests over a persistent websocket connection by the request id.
+type wsTransport struct {
+	endpoint string
+	dialer   *websocket.Dialer
+	// timeout is the time limit of the dials which are not made by a call, zero means no timeout.
+	timeout      time.Duration
+	pingInterval time.Duration
+	lastID       uint64
+	done         chan struct{}
+
+	mu          sync.Mutex
+	conn        *wsConn
+	closed      bool
+	handlers    map[int]func(*Notification)
+	lastHandler int
+	// dialing is closed when the dial in progress is done, nil if there is none.
+	dialing chan struct{}
+}
+
+// wsConn is a websocket connection and the calls waiting for its responses.
+type wsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]chan *clientResponse
+	// dead is set when the connection is broken, no more calls are accepted.
+	dead bool
+	// closed is closed when the connection is broken.
+	closed chan struct{}
+}
+
+// wsMessage is a response or a notification.
+type wsMessage struct {
+	clientResponse
+	Method Event `json:"method"`
+	Params []struct {
+		Gid string `json:"gid"`
+	} `json:"params"`
+}
+
+func newWSTransport(endpoint string, dialer *websocket.Dialer, timeout time.Duration) *wsTransport {
+	return &wsTransport{
+		endpoint:     endpoint,
+		dialer:       dialer,
+		timeout:      timeout,
+		pingInterval: pingInterval,
+		done:         make(chan struct{}),
+		handlers:     make(map[int]func(*Notification)),
+	}
+}
+
+// connection returns the current connection, a new one is dialed if it's not connected.
+// Only one dial is made at a time without holding mu, the other callers wait for it.
+func (t *wsTransport) connection(ctx context.Context) (*wsConn, error) {
+	for {
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return nil, ErrConnectionClosed
+		}
+		if t.conn != nil {
+			c := t.conn
+			t.mu.Unlock()
+			return c, nil
+		}
+		if dialing := t.dialing; dialing != nil {
+			t.mu.Unlock()
+			select {
+			case <-dialing:
+				// connected, or failed and the next caller dials again.
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		dialing := make(chan struct{})
+		t.dialing = dialing
+		t.mu.Unlock()
+
+		c, err := t.dial(ctx)
+		t.mu.Lock()
+		t.dialing = nil
+		close(dialing)
+		if err == nil && t.closed {
+			c.conn.Close()
+			err = ErrConnectionClosed
+		}
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.conn = c
+		go t.read(c)
+		go t.ping(c)
+		t.mu.Unlock()
+		return c, nil
+	}
+}
+
+// dial connects to the endpoint, the dial is aborted by close or the context.
+func (t *wsTransport) dial(ctx context.Context) (*wsConn, error) {
+	// the handshake only observes the deadline of the context, so the connection is closed to abort it.
+	var (
+		mu       sync.Mutex
+		raw      net.Conn
+		finished bool
+		aborted  bool
+	)
+	dialer := *t.dialer
+	netDial := dialer.NetDialContext
+	if netDial == nil && dialer.NetDial != nil {
+		netDial = func(_ context.Context, network, addr string) (net.Conn, error) {
+			return t.dialer.NetDial(network, addr)
+		}
+	}
+	if netDial == nil {
+		netDial = (&net.Dialer{}).DialContext
+	}
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := netDial(ctx, network, addr)
+		if err == nil {
+			mu.Lock()
+			raw = conn
+			mu.Unlock()
+		}
+		return conn, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-t.done:
+		case <-ctx.Done():
+		}
+		mu.Lock()
+		if !finished && raw != nil {
+			raw.Close()
+			aborted = true
+		}
+		mu.Unlock()
+	}()
+	conn, _, err := dialer.DialContext(ctx, t.endpoint, nil)
+	mu.Lock()
+	finished = true
+	if aborted && err == nil {
+		// the handshake is done just before the connection is closed.
+		conn.Close()
+		err = ErrConnectionClosed
+	}
+	mu.Unlock()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	c := &wsConn{conn: conn, pending: make(map[uint64]chan *clientResponse), closed: make(chan struct{})}
+	t.extendDeadline(c)
+	conn.SetPongHandler(func(string) error {
+		t.extendDeadline(c)
+		return nil
+	})
+	return c, nil
+}
+
+// connect is like connection but with the time limit of the client, it's used to dial without a call.
+func (t *wsTransport) connect() error {
+	ctx := context.Background()
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	_, err := t.connection(ctx)
+	return err
+}
+
+// extendDeadline allows two ping intervals for the next message or pong of the connection.
+func (t *wsTransport) extendDeadline(c *wsConn) {
+	c.conn.SetReadDeadline(time.Now().Add(2 * t.pingInterval))
+}
+
+// ping sends pings until the connection is broken, so a half-open connection fails the read by the deadline.
+func (t *wsTransport) ping(c *wsConn) {
+	ticker := time.NewTicker(t.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+		if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(t.pingInterval)); err != nil {
+			// the reading goroutine handles the broken connection.
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+func (t *wsTransport) call(ctx context.Context, method string, params []interface{}, reply interface{}) error {
+	c, err := t.connection(ctx)
+	if err != nil {
+		return err
+	}
+	id := atomic.AddUint64(&t.lastID, 1)
+	b, err := encodeClientRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *clientResponse, 1)
+	c.mu.Lock()
+	if c.dead {
+		c.mu.Unlock()
+		return ErrConnectionClosed
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+	c.writeMu.Lock()
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	err = c.conn.WriteMessage(websocket.TextMessage, b)
+	c.writeMu.Unlock()
+	if err != nil {
+		// the reading goroutine fails the pending calls.
+		c.conn.Close()
+		return err
+	}
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			return ErrConnectionClosed
+		}
+		return resp.decode(reply)
+	case <-ctx.Done():
+		// the response is dropped by the reading goroutine if it arrives later.
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// read dispatches the messages of the connection until it's broken, and reconnects if there are subscribers.
+func (t *wsTransport) read(c *wsConn) {
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		t.extendDeadline(c)
+		var msg wsMessage
+		if err := json.Unmarshal(b, &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			for _, param := range msg.Params {
+				t.notify(&Notification{Event: msg.Method, Gid: param.Gid})
+			}
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[msg.Id]
+		delete(c.pending, msg.Id)
+		c.mu.Unlock()
+		if ok {
+			ch <- &msg.clientResponse
+		}
+	}
+	c.conn.Close()
+	close(c.closed)
+	c.mu.Lock()
+	c.dead = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+
+	t.mu.Lock()
+	if t.conn == c {
+		t.conn = nil
+	}
+	reconnect := !t.closed && len(t.handlers) > 0
+	t.mu.Unlock()
+	if reconnect {
+		t.reconnect()
+	}
+}
+
+// reconnect dials with exponential backoff until it's connected or closed, then sends EventReconnected.
+func (t *wsTransport) reconnect() {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 100 * time.Millisecond
+	b.MaxInterval = 30 * time.Second
+	b.MaxElapsedTime = 0
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-time.After(b.NextBackOff()):
+		}
+		if err := t.connect(); err == nil {
+			break
+		}
+	}
+	t.notify(&Notification{Event: EventReconnected})
+}
+
+func (t *wsTransport) notify(n *Notification) {
+	t.mu.Lock()
+	handlers := make([]func(*Notification), 0, len(t.handlers))
+	for _, handler := range t.handlers {
+		handlers = append(handlers, handler)
+	}
+	t.mu.Unlock()
+	for _, handler := range handlers {
+		handler(n)
+	}
+}
+
+func (t *wsTransport) subscribe(handler func(*Notification)) (func(), error) {
+	t.mu.Lock()
+	t.lastHandler++
+	key := t.lastHandler
+	t.handlers[key] = handler
+	t.mu.Unlock()
+	unsubscribe := func() {
+		t.mu.Lock()
+		delete(t.handlers, key)
+		t.mu.Unlock()
+	}
+	if err := t.connect(); err != nil {
+		unsubscribe()
+		return nil, err
+	}
+	return unsubscribe, nil
+}
+
+func (t *wsTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	if t.conn != nil {
+		return t.conn.conn.Close()
+	}
+	return nil
+}
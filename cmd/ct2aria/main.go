@@ -4,44 +4,138 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"os/signal"
 	"path"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v3"
-	"go.uber.org/ratelimit"
 
 	"github.com/hr3lxphr6j/ctfile/aria2"
 	"github.com/hr3lxphr6j/ctfile/ctfile"
+	"github.com/hr3lxphr6j/ctfile/download"
 	"github.com/hr3lxphr6j/ctfile/utils"
 )
 
 var (
 	shareIDs      []string
 	pubCookie     string
+	username      string
+	password      string
 	aria2Endpoint string
 	aria2Token    string
+	aria2Timeout  time.Duration
 	aria2Output   string
 	concurrent    int
+	walkWorkers   int
+	excludes      []string
+	passcodeFile  string
+	apiEndpoint   string
+	origin        string
+	proxy         string
+	timeout       time.Duration
+	debug         bool
+	recordDir     string
+	cacheDir      string
+	cacheTTL      time.Duration
+	backend       string
+	output        string
+	connections   int
+	maxConns      int
+	bandwidth     int64
 )
 
 func init() {
 	flag.StringVar(&pubCookie, "cookie", "", "pub cookie of ctfile")
-	flag.StringVar(&aria2Endpoint, "aria2-endpoint", "http://127.0.0.1:6800/jsonrpc", "endpoint of aria2 rpc")
+	flag.StringVar(&username, "username", "", "username of ctfile, used when cookie is empty")
+	flag.StringVar(&password, "password", "", "password of ctfile, used when cookie is empty")
+	flag.StringVar(&aria2Endpoint, "aria2-endpoint", "http://127.0.0.1:6800/jsonrpc", "endpoint of aria2 rpc, ws:// endpoint receives notifications instead of polling")
 	flag.StringVar(&aria2Token, "aria2-token", "", "token of aria2 rpc")
+	flag.DurationVar(&aria2Timeout, "aria2-timeout", 30*time.Second, "timeout of every aria2 rpc call, no timeout if 0")
 	flag.StringVar(&aria2Output, "aria2-output", "", "output path")
 	flag.IntVar(&concurrent, "concurrent", 5, "concurrent of download")
-	flag.Parse()
-	shareIDs = flag.Args()
+	flag.IntVar(&walkWorkers, "walk-concurrent", 4, "concurrent of listing folders")
+	flag.StringVar(&passcodeFile, "passcode-file", "", "file of passcodes, each line is a share id and its passcode")
+	flag.Var((*stringsFlag)(&excludes), "exclude", "glob pattern of folders to skip, matches the path or the name, can be repeated")
+	flag.StringVar(&apiEndpoint, "api-endpoint", "", "endpoint of ctfile web api, use default if empty")
+	flag.StringVar(&origin, "origin", "", "origin of ctfile web page, use default if empty")
+	flag.StringVar(&proxy, "proxy", "", "proxy url of ctfile web api, e.g. http://127.0.0.1:1080")
+	flag.DurationVar(&timeout, "timeout", time.Minute, "timeout of every ctfile web api request")
+	flag.BoolVar(&debug, "debug", false, "log every ctfile web api request")
+	flag.StringVar(&recordDir, "record", "", "directory to save the responses of ctfile web api")
+	flag.StringVar(&cacheDir, "cache", "", "directory to cache the listing of folders, no cache if empty")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 24*time.Hour, "time to use the cached listing without revalidation")
+	flag.StringVar(&backend, "backend", backendAria2, "download backend, aria2 or native")
+	flag.StringVar(&output, "output", "", "output directory of the native backend, use aria2-output if empty")
+	flag.IntVar(&connections, "connections", 4, "connections of a file of the native backend")
+	flag.IntVar(&maxConns, "max-connections", 0, "connections of all files of the native backend, unlimited if 0")
+	flag.Int64Var(&bandwidth, "bandwidth", 0, "bandwidth limit of the native backend in bytes per second, unlimited if 0")
+}
+
+// stringsFlag is a flag which can be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	if _, err := path.Match(value, ""); err != nil {
+		return err
+	}
+	*s = append(*s, value)
+	return nil
 }
 
+// isExcluded reports whether the folder matches any of the exclude patterns.
+func isExcluded(folder string) bool {
+	for _, pattern := range excludes {
+		if ok, _ := path.Match(pattern, folder); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(folder)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeName reports whether the name of a file or folder in the share is a single safe element of a path,
+// so it can not escape the output directory.
+func isSafeName(name string) bool {
+	return !strings.Contains(name, "/") && download.CheckPath(name) == nil
+}
+
+const (
+	backendAria2  = "aria2"
+	backendNative = "native"
+)
+
 type (
-	aria2ClientKey  struct{}
 	ctfileClientKey struct{}
-	rateLimitKey    struct{}
+	downloaderKey   struct{}
+	stopKey         struct{}
 )
 
+// stopError wraps the error after which no file can be downloaded any more, the run is stopped gracefully.
+type stopError struct {
+	err error
+}
+
+func (e *stopError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stopError) Unwrap() error {
+	return e.err
+}
+
 type task struct {
 	Done chan struct{}
 	once sync.Once
@@ -49,7 +143,8 @@ type task struct {
 	File    *ctfile.File
 	CurPath string
 
-	Gid string
+	// ID is the id of the download in the downloader.
+	ID  string
 	Err error
 
 	hooks []func(task *task)
@@ -76,92 +171,271 @@ func newTask(file *ctfile.File, curPath string, hooks ...func(task *task)) *task
 	}
 }
 
-func waitTask(ctx context.Context, task *task) {
-	client := ctx.Value(aria2ClientKey{}).(*aria2.Client)
-	t := time.NewTicker(time.Second)
-	defer t.Stop()
-	for {
-		select {
-		case <-ctx.Done():
+// tracker finishes the tasks by the events of the downloader.
+type tracker struct {
+	mu    sync.Mutex
+	tasks map[string]*task
+}
+
+func newTracker() *tracker {
+	return &tracker{tasks: make(map[string]*task)}
+}
+
+// add adds the download of the task and tracks it, the lock is held while adding,
+// so the events of the download are handled after the task is tracked.
+func (tr *tracker) add(ctx context.Context, downloader download.Downloader, task *task, urls []string) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	id, err := downloader.Add(ctx, &download.Request{
+		Path: path.Join(task.CurPath, task.File.Name),
+		URLs: urls,
+	})
+	if err != nil {
+		return err
+	}
+	task.ID = id
+	tr.tasks[id] = task
+	return nil
+}
+
+// run handles the events until the channel is closed.
+func (tr *tracker) run(events <-chan download.Event) {
+	for ev := range events {
+		if !ev.State.Finished() {
+			continue
+		}
+		tr.mu.Lock()
+		task, ok := tr.tasks[ev.ID]
+		delete(tr.tasks, ev.ID)
+		tr.mu.Unlock()
+		if !ok {
+			continue
+		}
+		switch {
+		case ev.State == download.StateError:
+			log.Printf("failed to download, filename: %s, err: %v", task.File.Name, ev.Err)
+			task.SetDone(ev.Err)
+		case ev.State == download.StateCanceled && ev.Err != nil:
+			log.Printf("download is gone, filename: %s, err: %v", task.File.Name, ev.Err)
+			task.SetDone(ev.Err)
+		default:
+			// the download is complete, or canceled by user which is no need to retry.
+			task.SetDone(nil)
+		}
+	}
+}
+
+// requeueHook returns the hook of a task which is not retried by reWalk, e.g. the file of a single file share.
+// The failed task is sent to pendingCh again after the backoff until the max retries,
+// wg is done once the task succeeds or is given up.
+func requeueHook(ctx context.Context, pendingCh chan<- *task, b backoff.BackOff, wg *sync.WaitGroup) func(task *task) {
+	var hook func(task *task)
+	hook = func(t *task) {
+		if t.Err == nil || ctx.Err() != nil {
+			wg.Done()
 			return
-		case <-t.C:
-			status, err := client.TellStatus(task.Gid)
-			if err != nil {
-				// task was removed.
-				task.SetDone(nil)
+		}
+		d := b.NextBackOff()
+		if d == backoff.Stop {
+			log.Printf("failed to download after max retry, filename: %s, err: %v", t.File.Name, t.Err)
+			wg.Done()
+			return
+		}
+		log.Printf("failed to download, filename: %s, will retry after %s", t.File.Name, d)
+		go func() {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				wg.Done()
 				return
 			}
-			switch status.Status {
-			case aria2.StatusComplete:
-				task.SetDone(nil)
-				return
-			case aria2.StatusError:
-				task.SetDone(errors.New(status.ErrorMessage))
-				return
-			default:
-				continue
+			select {
+			case pendingCh <- newTask(t.File, t.CurPath, hook):
+			case <-ctx.Done():
+				wg.Done()
 			}
+		}()
+	}
+	return hook
+}
+
+// isShareUnavailable reports whether the share can not be accessed, which is no need to retry.
+func isShareUnavailable(err error) bool {
+	return errors.Is(err, ctfile.ErrPasscodeRequired) || errors.Is(err, ctfile.ErrWrongPasscode) ||
+		errors.Is(err, ctfile.ErrShareNotFound)
+}
+
+var loginLock sync.Mutex
+
+// renewSession logins again and gets the download urls of the file, it must be called with loginLock held.
+func renewSession(ctx context.Context, client *ctfile.Client, file *ctfile.File) (map[string]string, error) {
+	// another consumer may have renewed the session while waiting for the lock.
+	urls, err := client.GetDownloadUrlContext(ctx, file)
+	if !errors.Is(err, ctfile.ErrNotLoggedIn) {
+		return urls, err
+	}
+	log.Printf("session of ctfile is expired, re-login...")
+	err = client.LoginContext(ctx, username, password)
+	switch {
+	case errors.Is(err, ctfile.ErrWrongPassword), errors.Is(err, ctfile.ErrCaptchaRequired),
+		errors.Is(err, ctfile.ErrAccountLocked):
+		return nil, &stopError{fmt.Errorf("failed to login: %w", err)}
+	case err != nil:
+		return nil, fmt.Errorf("failed to login: %w", err)
+	}
+	return client.GetDownloadUrlContext(ctx, file)
+}
+
+// getDownloadUrl gets the download urls of the file, the session is renewed once if it's expired.
+// Rate limit and retry of the requests are done by the ctfile client.
+func getDownloadUrl(ctx context.Context, client *ctfile.Client, file *ctfile.File) (map[string]string, error) {
+	urls, err := client.GetDownloadUrlContext(ctx, file)
+	if errors.Is(err, ctfile.ErrNotLoggedIn) {
+		if username == "" {
+			return nil, &stopError{fmt.Errorf("session of ctfile is expired: %w", err)}
 		}
+		loginLock.Lock()
+		urls, err = renewSession(ctx, client, file)
+		loginLock.Unlock()
+	}
+	switch {
+	case errors.Is(err, ctfile.ErrNotVIP), errors.Is(err, ctfile.ErrQuotaExceeded):
+		return nil, &stopError{err}
+	case err != nil:
+		return nil, err
+	case len(urls) == 0:
+		return nil, errors.New("url is empty")
 	}
+	return urls, nil
 }
 
-func consumer(ctx context.Context, pendingCh <-chan *task) {
-	aria2Client := ctx.Value(aria2ClientKey{}).(*aria2.Client)
+func consumer(ctx context.Context, tr *tracker, pendingCh <-chan *task) {
 	ctfileClient := ctx.Value(ctfileClientKey{}).(*ctfile.Client)
-	rl := ctx.Value(rateLimitKey{}).(ratelimit.Limiter)
+	downloader := ctx.Value(downloaderKey{}).(download.Downloader)
+	stop := ctx.Value(stopKey{}).(func(err error))
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case task := <-pendingCh:
+		case task, ok := <-pendingCh:
+			if !ok {
+				return
+			}
 			log.Printf("File: %s, Size: %s", task.File.Name, task.File.Size)
-			rl.Take()
-			var urls map[string]string
-			err := backoff.Retry(func() error {
-				_urls_, _err_ := ctfileClient.GetDownloadUrl(task.File)
-				if _err_ != nil {
-					return _err_
-				}
-				if len(_urls_) == 0 {
-					return errors.New("url is empty")
-				}
-				urls = _urls_
-				return nil
-			}, backoff.NewExponentialBackoffBuilder().MaxRetries(3).Build())
-
+			urls, err := getDownloadUrl(ctx, ctfileClient, task.File)
+			var stopErr *stopError
+			if errors.As(err, &stopErr) {
+				// stop before the task is done, so the failed task is not retried.
+				stop(err)
+				task.SetDone(err)
+				return
+			}
 			if err != nil {
-				log.Printf("failed to get download url after max retry, filename: %s, err: %s", task.File.Name, err)
+				log.Printf("failed to get download url, filename: %s, err: %s", task.File.Name, err)
 				task.SetDone(err)
 				continue
 			}
-
-			gid, err := aria2Client.AddUri(
-				utils.Map2slice(urls),
-				aria2.Output(path.Join(task.CurPath, task.File.Name)),
-				aria2.Directory(aria2Output),
-			)
-			if err != nil {
-				log.Fatalf("failed to call aria2.AddUri, err: %s", err)
+			if err := tr.add(ctx, downloader, task, utils.Map2slice(urls)); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("failed to add download, filename: %s, err: %s", task.File.Name, err)
+				task.SetDone(err)
+				continue
+			}
+			// the partial download is kept if ctx is done, and resumed by the next run.
+			select {
+			case <-task.Done:
+			case <-ctx.Done():
+				return
 			}
-			task.Gid = gid
-			waitTask(ctx, task)
 		}
 	}
 }
 
 func main() {
+	flag.Parse()
+	shareIDs = flag.Args()
 	if len(shareIDs) == 0 {
 		log.Fatal("no input")
 	}
+	links := make([]*ctfile.Link, 0, len(shareIDs))
+	for _, id := range shareIDs {
+		link, err := ctfile.ParseLink(id)
+		if err != nil {
+			log.Fatalf("invalid input %s, error %v", id, err)
+		}
+		links = append(links, link)
+	}
 	if concurrent <= 0 {
 		log.Fatal("concurrent must be greater than 0")
 	}
+	if backend != backendAria2 && backend != backendNative {
+		log.Fatalf("unknown backend %s", backend)
+	}
+	if output == "" {
+		output = aria2Output
+	}
 
-	ctfileClient := ctfile.NewClient()
+	opts := []ctfile.Option{
+		ctfile.WithTimeout(timeout),
+		ctfile.WithRateLimiter(ctfile.NewRateLimiter(30)),
+		ctfile.WithRetryPolicy(ctfile.DefaultRetryPolicy),
+	}
+	if apiEndpoint != "" {
+		opts = append(opts, ctfile.WithAPIEndpoint(apiEndpoint))
+	}
+	if origin != "" {
+		opts = append(opts, ctfile.WithOrigin(origin))
+	}
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			log.Fatalf("invalid proxy url, error %v", err)
+		}
+		opts = append(opts, ctfile.WithProxy(u))
+	}
+	if debug {
+		opts = append(opts, ctfile.WithMiddleware(ctfile.LoggingMiddleware(nil)))
+	}
+	if recordDir != "" {
+		opts = append(opts, ctfile.WithMiddleware(ctfile.RecordMiddleware(recordDir)))
+	}
+	if cacheDir != "" {
+		opts = append(opts, ctfile.WithCache(ctfile.NewDiskCache(cacheDir), cacheTTL))
+	}
+	keyring := make(map[string]string)
+	if passcodeFile != "" {
+		var err error
+		if keyring, err = loadKeyring(passcodeFile); err != nil {
+			log.Fatalf("failed to load passcode file, error %v", err)
+		}
+	}
+	opts = append(opts, ctfile.WithPasscodeProvider(newPasscodeProvider(keyring)))
+	ctfileClient := ctfile.NewClient(opts...)
 	if pubCookie != "" {
 		if err := ctfileClient.SetCookies(pubCookie); err != nil {
 			log.Fatalf("failed to set cookie, error %v", err)
 		}
+	} else if username != "" {
+		if err := ctfileClient.Login(username, password); err != nil {
+			log.Fatalf("failed to login, error %v", err)
+		}
+		log.Print("login success")
+	} else {
+		log.Fatal("cookie or username is required")
+	}
+	account, err := ctfileClient.Account()
+	if err != nil {
+		log.Fatalf("failed to get account info, error %v", err)
+	}
+	if !account.IsVIP() {
+		log.Fatalf("account %s is not a vip or the vip is expired, can not download", account.Username)
+	}
+	log.Printf("account: %s, vip level: %d, vip expiry: %s",
+		account.Username, account.VIPLevel, account.VIPExpiry.Format("2006-01-02"))
+	if account.QuotaExceeded() {
+		log.Printf("warning: daily traffic quota of account %s is used up", account.Username)
 	}
 
 	var (
@@ -169,32 +443,116 @@ func main() {
 		ctx, cancel = context.WithCancel(context.TODO())
 		wg          = sync.WaitGroup{}
 		reWalk      = make(chan struct{}, 1)
+		fileWg      = sync.WaitGroup{}
 	)
 	ctx = context.WithValue(ctx, ctfileClientKey{}, ctfileClient)
-	ctx = context.WithValue(ctx, rateLimitKey{}, ratelimit.New(30))
-	ctx = context.WithValue(ctx, aria2ClientKey{}, aria2.New(aria2Endpoint, aria2Token))
+	// stop is called by the consumers once no file can be downloaded any more.
+	var (
+		stopOnce sync.Once
+		stopErr  error
+	)
+	ctx = context.WithValue(ctx, stopKey{}, func(err error) {
+		stopOnce.Do(func() {
+			log.Printf("can not download any more, shutting down..., err: %v", err)
+			stopErr = err
+			cancel()
+		})
+	})
+
+	// cancel in-flight requests on shutdown.
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		sig := <-sigCh
+		log.Printf("received signal %s, shutting down...", sig)
+		cancel()
+	}()
+	var downloader download.Downloader
+	if backend == backendNative {
+		downloader = download.NewNativeDownloader(download.NewEngine(
+			download.WithConnections(connections),
+			download.WithMaxConnections(maxConns),
+			download.WithBandwidth(bandwidth),
+		), output)
+	} else {
+		downloader = download.NewAria2Downloader(aria2.New(aria2Endpoint, aria2Token, aria2.WithTimeout(aria2Timeout)), aria2Output)
+	}
+	ctx = context.WithValue(ctx, downloaderKey{}, downloader)
+	tr := newTracker()
+	go tr.run(downloader.Events())
 
-	// process pending chan, add task to aria2.
+	// process pending chan, add task to the downloader.
 	for i := 0; i < concurrent; i++ {
 		wg.Add(1)
 		go func() {
-			consumer(ctx, pendingCh)
+			consumer(ctx, tr, pendingCh)
 			wg.Done()
 		}()
 	}
 
 LoopShare:
-	for _, id := range shareIDs {
+	for _, link := range links {
+		id := link.String()
 		finishedFile := make(map[string]struct{}, 64)
 		finishedFileLock := new(sync.RWMutex)
 		b := backoff.NewExponentialBackoffBuilder().MaxRetries(10).Build()
+		if link.Type == ctfile.TypeFile {
+			fileWg.Add(1)
+			var file *ctfile.File
+			err := backoff.Retry(func() (err error) {
+				// the bare share ID of the link is taken as a shared file.
+				file, err = ctfileClient.GetFileShareInfoContext(ctx, id)
+				return err
+			}, backoff.WithContext(b, ctx))
+			if ctx.Err() != nil {
+				break LoopShare
+			}
+			if isShareUnavailable(err) {
+				log.Printf("skip share %s, err: %v", id, err)
+				fileWg.Done()
+				continue LoopShare
+			}
+			if err != nil {
+				log.Fatalf("failed to get file share after max retry, id: %s, err: %v", id, err)
+			}
+			if !isSafeName(file.Name) {
+				log.Printf("skip share %s, unsafe name %q", id, file.Name)
+				fileWg.Done()
+				continue LoopShare
+			}
+			hook := requeueHook(ctx, pendingCh, backoff.NewExponentialBackoffBuilder().MaxRetries(10).Build(), &fileWg)
+			select {
+			case pendingCh <- newTask(file, "", hook):
+				continue LoopShare
+			case <-ctx.Done():
+				break LoopShare
+			}
+		}
 	LoopWalk:
 		for {
-			err := ctfileClient.Walk(id, "", func(curPath string, share *ctfile.Share, file *ctfile.File) bool {
+			err := ctfileClient.WalkDirConcurrent(ctx, id, link.FolderID, walkWorkers, func(curPath string, share *ctfile.Share, file *ctfile.File, err error) error {
+				if err != nil {
+					return err
+				}
+				if !isSafeName(file.Name) {
+					log.Printf("skip unsafe name %q in %s", file.Name, curPath)
+					if file.Type == ctfile.TypeFolder {
+						return ctfile.SkipDir
+					}
+					return nil
+				}
+				if file.Type == ctfile.TypeFolder {
+					if isExcluded(path.Join(curPath, file.Name)) {
+						log.Printf("skip excluded folder: %s", path.Join(curPath, file.Name))
+						return ctfile.SkipDir
+					}
+					return nil
+				}
+
 				finishedFileLock.RLock()
 				if _, ok := finishedFile[path.Join(curPath, file.Name)]; ok {
 					finishedFileLock.RUnlock()
-					return true
+					return nil
 				}
 				finishedFileLock.RUnlock()
 
@@ -212,20 +570,27 @@ LoopShare:
 				})
 				select {
 				case pendingCh <- task:
-					return true
+					return nil
 				case <-reWalk:
 					reWalk = make(chan struct{}, 1)
-					return false
+					return ctfile.ErrWalkAbort
+				case <-ctx.Done():
+					return ctx.Err()
 				}
 			})
 
-			switch err {
-			case nil:
+			switch {
+			case err == nil:
 				// TODO: wait all task finish.
 				continue LoopShare
-			case ctfile.ErrWalkAbort:
+			case err == context.Canceled:
+				break LoopShare
+			case err == ctfile.ErrWalkAbort:
 				log.Print("some error happen, trigger reWalk...")
 				continue LoopWalk
+			case isShareUnavailable(err):
+				log.Printf("skip share %s, err: %v", id, err)
+				continue LoopShare
 			default:
 				d := b.NextBackOff()
 				if d == backoff.Stop {
@@ -238,6 +603,21 @@ LoopShare:
 		}
 	}
 
-	cancel()
+	// wait for the files of single file shares, which may be requeued, then the pending tasks, or the shutdown.
+	fileDone := make(chan struct{})
+	go func() {
+		fileWg.Wait()
+		close(fileDone)
+	}()
+	select {
+	case <-fileDone:
+		close(pendingCh)
+	case <-ctx.Done():
+	}
 	wg.Wait()
+	cancel()
+	downloader.Close()
+	if stopErr != nil {
+		log.Fatalf("can not download any more, err: %v", stopErr)
+	}
 }
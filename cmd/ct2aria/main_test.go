@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile"
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+	"github.com/hr3lxphr6j/ctfile/download"
+	"github.com/hr3lxphr6j/ctfile/download/downloadtest"
+)
+
+// newPipeline starts the consumers of the tasks with a fake downloader and a VIP logged in a fake ctfile server.
+func newPipeline(t *testing.T) (*ctfiletest.Server, *downloadtest.Downloader, func(*task), func()) {
+	t.Helper()
+	srv := ctfiletest.NewServer()
+	srv.AddUser(&ctfiletest.User{
+		ID: 1, Username: "alice", Password: "secret",
+		VIPLevel: 1, VIPExpiry: time.Now().Add(time.Hour),
+	})
+	client := ctfile.NewClient(ctfile.WithAPIEndpoint(srv.URL), ctfile.WithOrigin(srv.URL))
+	if err := client.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	downloader := downloadtest.NewDownloader()
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, ctfileClientKey{}, client)
+	ctx = context.WithValue(ctx, downloaderKey{}, downloader)
+	ctx = context.WithValue(ctx, stopKey{}, func(err error) { cancel() })
+	tr := newTracker()
+	go tr.run(downloader.Events())
+	pendingCh := make(chan *task)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer(ctx, tr, pendingCh)
+		}()
+	}
+	send := func(task *task) {
+		pendingCh <- task
+	}
+	stop := func() {
+		close(pendingCh)
+		wg.Wait()
+		cancel()
+		downloader.Close()
+		srv.Close()
+	}
+	return srv, downloader, send, stop
+}
+
+// addFile adds a single file share and returns the file of it.
+func addFile(t *testing.T, srv *ctfiletest.Server, id, name string) *ctfile.File {
+	t.Helper()
+	srv.AddFileShare(&ctfiletest.FileShare{
+		ID: id, UserID: 1, Username: "alice",
+		File: &ctfiletest.File{Name: name, Content: []byte(name)},
+	})
+	client := ctfile.NewClient(ctfile.WithAPIEndpoint(srv.URL), ctfile.WithOrigin(srv.URL))
+	file, err := client.GetFileShareInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func waitDone(t *testing.T, task *task) {
+	t.Helper()
+	select {
+	case <-task.Done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("task of %s is not done", task.File.Name)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	srv, downloader, send, stop := newPipeline(t)
+	defer stop()
+	downloader.SetAutoComplete(true)
+
+	task := newTask(addFile(t, srv, "1-1-a", "a.txt"), "dir/sub")
+	send(task)
+	waitDone(t, task)
+	if task.Err != nil {
+		t.Errorf("task is done with %v", task.Err)
+	}
+	reqs := downloader.Requests()
+	if len(reqs) != 1 || reqs[0].Path != "dir/sub/a.txt" || len(reqs[0].URLs) == 0 {
+		t.Errorf("requests of the downloader = %+v, want dir/sub/a.txt with urls", reqs)
+	}
+}
+
+func TestConsumer_Error(t *testing.T) {
+	srv, downloader, send, stop := newPipeline(t)
+	defer stop()
+
+	task := newTask(addFile(t, srv, "1-1-b", "b.txt"), "")
+	go send(task)
+	var (
+		id string
+		ok bool
+	)
+	for !ok {
+		time.Sleep(10 * time.Millisecond)
+		id, ok = downloader.ID("b.txt")
+	}
+	failure := errors.New("network problem")
+	if err := downloader.Fail(id, failure); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, task)
+	if task.Err != failure {
+		t.Errorf("task is done with %v, want %v", task.Err, failure)
+	}
+
+	// the canceled download is done without error.
+	task = newTask(addFile(t, srv, "1-1-c", "c.txt"), "")
+	go send(task)
+	for ok = false; !ok; {
+		time.Sleep(10 * time.Millisecond)
+		id, ok = downloader.ID("c.txt")
+	}
+	if err := downloader.Cancel(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, task)
+	if task.Err != nil {
+		t.Errorf("canceled task is done with %v", task.Err)
+	}
+}
+
+func TestRequeueHook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pendingCh := make(chan *task, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	hook := requeueHook(ctx, pendingCh, backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1), &wg)
+	file := &ctfile.File{Name: "a.txt"}
+
+	newTask(file, "dir", hook).SetDone(errors.New("network problem"))
+	var retry *task
+	select {
+	case retry = <-pendingCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed task is not requeued")
+	}
+	if retry.File != file || retry.CurPath != "dir" {
+		t.Errorf("requeued task of %s/%s, want dir/a.txt", retry.CurPath, retry.File.Name)
+	}
+
+	// the max retries is exceeded, the task is given up.
+	retry.SetDone(errors.New("network problem"))
+	wg.Wait()
+	select {
+	case <-pendingCh:
+		t.Error("task is requeued after max retries")
+	default:
+	}
+}
+
+func TestGetDownloadUrl_Stop(t *testing.T) {
+	srv := ctfiletest.NewServer()
+	defer srv.Close()
+	srv.AddUser(&ctfiletest.User{ID: 1, Username: "alice", Password: "secret"})
+	client := ctfile.NewClient(ctfile.WithAPIEndpoint(srv.URL), ctfile.WithOrigin(srv.URL))
+	if err := client.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := getDownloadUrl(context.Background(), client, addFile(t, srv, "1-1-a", "a.txt"))
+	var stopErr *stopError
+	if !errors.As(err, &stopErr) || !errors.Is(err, ctfile.ErrNotVIP) {
+		t.Errorf("getDownloadUrl() = %v, want a stop error of %v", err, ctfile.ErrNotVIP)
+	}
+}
+
+func TestConsumer_AddError(t *testing.T) {
+	srv, downloader, send, stop := newPipeline(t)
+	defer stop()
+	failure := errors.New("rpc problem")
+	downloader.SetAddError(failure)
+
+	task := newTask(addFile(t, srv, "1-1-d", "d.txt"), "")
+	send(task)
+	waitDone(t, task)
+	if task.Err != failure {
+		t.Errorf("task is done with %v, want %v", task.Err, failure)
+	}
+}
+
+func TestIsSafeName(t *testing.T) {
+	tests := map[string]bool{
+		"a.txt":         true,
+		"..":            false,
+		"../../.bashrc": false,
+		"a/b":           false,
+		`..\a`:          false,
+		"":              false,
+	}
+	for name, want := range tests {
+		if got := isSafeName(name); got != want {
+			t.Errorf("isSafeName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestTracker_Canceled(t *testing.T) {
+	tr := newTracker()
+	removed := newTask(&ctfile.File{Name: "removed.txt"}, "")
+	gone := newTask(&ctfile.File{Name: "gone.txt"}, "")
+	tr.tasks["1"], tr.tasks["2"] = removed, gone
+	events := make(chan download.Event, 2)
+	events <- download.Event{ID: "1", State: download.StateCanceled}
+	events <- download.Event{ID: "2", State: download.StateCanceled, Err: download.ErrNotFound}
+	close(events)
+	tr.run(events)
+	waitDone(t, removed)
+	waitDone(t, gone)
+	if removed.Err != nil {
+		t.Errorf("task removed by user is done with %v", removed.Err)
+	}
+	if gone.Err != download.ErrNotFound {
+		t.Errorf("task gone from the downloader is done with %v, want %v", gone.Err, download.ErrNotFound)
+	}
+}
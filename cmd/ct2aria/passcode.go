@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile"
+)
+
+// loadKeyring reads the passcodes from the file, each line of which is a share ID and its passcode
+// separated by spaces, lines starting with '#' are ignored.
+func loadKeyring(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keyring := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a share id and a passcode", name, line)
+		}
+		link, err := ctfile.ParseLink(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		keyring[link.ShareID] = fields[1]
+	}
+	return keyring, scanner.Err()
+}
+
+// isTerminal reports whether the stdin is a terminal.
+func isTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// newPasscodeProvider returns a provider which looks up the keyring first, then prompts on the terminal.
+func newPasscodeProvider(keyring map[string]string) ctfile.PasscodeProvider {
+	var (
+		mu     sync.Mutex
+		tried  = make(map[string]bool)
+		stdin  = bufio.NewReader(os.Stdin)
+		prompt = isTerminal()
+	)
+	return func(ctx context.Context, shareID string, err error) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if passcode, ok := keyring[shareID]; ok && !tried[shareID] {
+			tried[shareID] = true
+			return passcode, nil
+		}
+		if !prompt {
+			return "", nil
+		}
+		if errors.Is(err, ctfile.ErrWrongPasscode) {
+			fmt.Fprintf(os.Stderr, "wrong passcode of share %s, please retry: ", shareID)
+		} else {
+			fmt.Fprintf(os.Stderr, "passcode of share %s: ", shareID)
+		}
+		line, rerr := stdin.ReadString('\n')
+		if rerr != nil && line == "" {
+			return "", rerr
+		}
+		return strings.TrimSpace(line), nil
+	}
+}
@@ -0,0 +1,167 @@
+package ctfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores the share information and the listing of folders for Client, it must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry of the key, ok is false if there is no entry.
+	Get(key string) (entry *CacheEntry, ok bool)
+	// Set stores the entry of the key, the error is ignored by Client because the cache is best effort.
+	Set(key string, entry *CacheEntry) error
+}
+
+// CacheEntry is the share information or the listing of a folder in the cache.
+type CacheEntry struct {
+	Share *Share
+	// Passcode is the passcode of the share, it's set as the cookie when the entry is used.
+	Passcode string
+	// Files is the complete listing of the folder, nil for the entry of the share information.
+	Files []*File
+	// ETag is the validator of the listing returned by web api, it's used to revalidate the expired entry.
+	ETag string
+	// Updated is the time of the entry being fetched or revalidated.
+	Updated time.Time
+}
+
+func (e *CacheEntry) clone() *CacheEntry {
+	entry := *e
+	if e.Share != nil {
+		share := *e.Share
+		entry.Share = &share
+	}
+	if e.Files != nil {
+		entry.Files = make([]*File, len(e.Files))
+		for i, file := range e.Files {
+			f := *file
+			entry.Files[i] = &f
+		}
+	}
+	return &entry
+}
+
+// WithCache sets the cache of the share information and the listing of folders, default is no cache.
+// The entry younger than ttl is used without any request, the older one is revalidated by the ETag of the listing.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cache = cache
+		c.cacheTTL = ttl
+	}
+}
+
+// cacheKey returns the key of the share information of the folder, folderID is empty for the root folder
+// requested without a folder ID, which is different from the key of its real ID.
+func cacheKey(shareID, folderID string) string {
+	return shareID + "/" + folderID
+}
+
+// cacheGet returns the entry of the key, fresh reports whether it's younger than the ttl.
+func (c *Client) cacheGet(key string) (entry *CacheEntry, fresh bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+	entry, ok := c.cache.Get(key)
+	if !ok || entry.Share == nil {
+		return nil, false
+	}
+	return entry, time.Since(entry.Updated) < c.cacheTTL
+}
+
+func (c *Client) cacheSet(key string, entry *CacheEntry) {
+	if c.cache != nil {
+		c.cache.Set(key, entry)
+	}
+}
+
+// listingKey returns the key of the listing of the folder of the share information, which is apart from
+// the key of the share information. The listing is keyed by the folder ID, because the share ID is not
+// always in the listing url.
+func listingKey(share *Share) string {
+	return fmt.Sprintf("files/%d/%d", share.UserID, share.FolderID)
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+// NewMemoryCache returns a Cache in memory.
+func NewMemoryCache() Cache {
+	return &memoryCache{entries: make(map[string]*CacheEntry)}
+}
+
+func (m *memoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return entry.clone(), true
+}
+
+func (m *memoryCache) Set(key string, entry *CacheEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = entry.clone()
+	return nil
+}
+
+type diskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a Cache which saves every entry as a json file in the directory,
+// the directory is created when the first entry is saved. The files contain the passcodes of the shares.
+func NewDiskCache(dir string) Cache {
+	return &diskCache{dir: dir}
+}
+
+func (d *diskCache) path(key string) string {
+	return filepath.Join(d.dir, strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(key)+".json")
+}
+
+func (d *diskCache) Get(key string) (*CacheEntry, bool) {
+	b, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := new(CacheEntry)
+	if err := json.Unmarshal(b, entry); err != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (d *diskCache) Set(key string, entry *CacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	// write to a temporary file first, so a crash never leaves a broken entry.
+	f, err := ioutil.TempFile(d.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), d.path(key))
+}
@@ -0,0 +1,149 @@
+package ctfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+)
+
+// walkPaths walks the share and returns the paths of all files and folders.
+func walkPaths(t *testing.T, c *Client, shareID string) []string {
+	t.Helper()
+	var paths []string
+	err := c.WalkDir(context.Background(), shareID, "", func(curPath string, share *Share, file *File, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path.Join(curPath, file.Name))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestClient_Cache(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(NewMemoryCache(), time.Hour))
+	want := walkPaths(t, c, "1-2-abc")
+	requests := srv.Requests()
+	if got := walkPaths(t, c, "1-2-abc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached walk = %v, want %v", got, want)
+	}
+	if n := srv.Requests() - requests; n != 0 {
+		t.Errorf("cached walk sent %d requests, want 0", n)
+	}
+}
+
+func TestClient_Cache_ListingWithoutShare(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	srv.SetListingWithoutShare(true)
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(NewMemoryCache(), time.Hour))
+	want := walkPaths(t, c, "1-2-abc")
+	requests := srv.Requests()
+	if got := walkPaths(t, c, "1-2-abc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached walk = %v, want %v", got, want)
+	}
+	if n := srv.Requests() - requests; n != 0 {
+		t.Errorf("cached walk sent %d requests, want 0", n)
+	}
+}
+
+func TestClient_Cache_Revalidate(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	srv.SetPageSize(1)
+	// every entry is expired immediately, so it's always revalidated.
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(NewMemoryCache(), 0))
+	want := walkPaths(t, c, "1-2-abc")
+	first := srv.Requests()
+	if got := walkPaths(t, c, "1-2-abc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("revalidated walk = %v, want %v", got, want)
+	}
+	// 4 folders, each is a request of the share information and a request of the first page.
+	if n := srv.Requests() - first; n != 8 {
+		t.Errorf("revalidated walk sent %d requests, want 8 (the first walk sent %d)", n, first)
+	}
+
+	share, err := c.GetShareInfo("1-2-abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.AddFile(share.FolderID, &ctfiletest.File{Name: "new.txt", Content: []byte("new")})
+	got := walkPaths(t, c, "1-2-abc")
+	if want := append(want, "root/new.txt"); !reflect.DeepEqual(got, want) {
+		t.Errorf("walk after change = %v, want %v", got, want)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctfile-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(NewDiskCache(dir), time.Hour))
+	want := walkPaths(t, c, "1-2-abc")
+
+	// a new client with the same directory, like a restart of the program.
+	requests := srv.Requests()
+	c = NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(NewDiskCache(dir), time.Hour))
+	if got := walkPaths(t, c, "1-2-abc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached walk = %v, want %v", got, want)
+	}
+	if n := srv.Requests() - requests; n != 0 {
+		t.Errorf("cached walk sent %d requests, want 0", n)
+	}
+
+	cache := NewDiskCache(dir)
+	if _, ok := cache.Get("1-2-abc/0"); ok {
+		t.Error("Get() of a missing key succeeded")
+	}
+	entry := &CacheEntry{
+		Share:   &Share{FolderID: 1, FolderName: "root"},
+		Files:   []*File{{Type: TypeFile, ID: "1-1", Name: "a.txt", SizeBytes: 3}},
+		ETag:    `"etag"`,
+		Updated: time.Now().Round(0),
+	}
+	if err := cache.Set("1-2-abc/1", entry); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := cache.Get("1-2-abc/1")
+	if !ok {
+		t.Fatal("Get() after Set() failed")
+	}
+	if !reflect.DeepEqual(got.Share, entry.Share) || !reflect.DeepEqual(got.Files, entry.Files) ||
+		got.ETag != entry.ETag || !got.Updated.Equal(entry.Updated) {
+		t.Errorf("Get() = %+v, want %+v", got, entry)
+	}
+}
+
+func TestClient_Cache_Passcode(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	cache := NewMemoryCache()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(cache, time.Hour))
+	walkPaths(t, c, "1234@1-3-def")
+
+	// the share information is served from the cache, but the listing is requested by StreamFiles.
+	c = NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithCache(cache, time.Hour))
+	share, err := c.GetShareInfo("1-3-def", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StreamFiles(share, func(page *Page) error { return nil }); err != nil {
+		t.Errorf("StreamFiles() of the cached share = %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package ctfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,14 +10,13 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	urlpkg "net/url"
-	"path"
 	"regexp"
-	"strings"
+	"sync"
+	"time"
 
+	"github.com/cenkalti/backoff/v3"
 	"github.com/dimchansky/utfbom"
 	"github.com/tidwall/gjson"
-
-	"github.com/hr3lxphr6j/ctfile/utils"
 )
 
 type Type uint8
@@ -26,16 +26,40 @@ const (
 	TypeFolder
 )
 
-var (
-	ErrWalkAbort = errors.New("walk abort")
-)
-
 type File struct {
 	Type Type
 	ID   string
 	Name string
+	// Size and Date are the original strings of the listing, e.g. "1.2 GB" and "2019-12-01".
 	Size string
 	Date string
+	// SizeBytes is parsed from Size, it's approximate because Size is rounded,
+	// the real size is in the range of SizeBytes ± SizeTolerance.
+	SizeBytes     int64
+	SizeTolerance int64
+	// ModTime is parsed from Date, it's zero if Date can not be parsed.
+	ModTime time.Time
+}
+
+type Account struct {
+	UserID   int
+	Username string
+	// VIPLevel is 0 for the normal user.
+	VIPLevel  int
+	VIPExpiry time.Time
+	// DailyQuota and DailyUsed are the download traffic of today in bytes.
+	DailyQuota int64
+	DailyUsed  int64
+}
+
+// IsVIP reports whether the account has an unexpired VIP membership.
+func (a *Account) IsVIP() bool {
+	return a.VIPLevel > 0 && time.Now().Before(a.VIPExpiry)
+}
+
+// QuotaExceeded reports whether the download traffic of today is used up.
+func (a *Account) QuotaExceeded() bool {
+	return a.DailyQuota > 0 && a.DailyUsed >= a.DailyQuota
 }
 
 type Share struct {
@@ -53,35 +77,116 @@ type Share struct {
 const (
 	apiEndpoint = "https://webapi.400gb.com"
 	origin      = "https://545c.com"
+	pubCookie   = "pubcookie"
 )
 
 type Client struct {
-	hc      *http.Client
-	isLogin bool
+	hc               *http.Client
+	passcodeProvider PasscodeProvider
+	passcodes        sync.Map
+	retryPolicy      RetryPolicy
+	rateLimiter      RateLimiter
+	middlewares      []Middleware
+	cache            Cache
+	cacheTTL         time.Duration
+	session          *session
+	endpoint         string
+	origin           string
+	userAgent        string
+	pageSize         int
+	pageConcurrency  int
+	// transport is the transport of hc without the middlewares, which is shared by the download client.
+	transport http.RoundTripper
 }
 
-func NewClient() *Client {
+func NewClient(opts ...Option) *Client {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		panic(err)
 	}
-	return &Client{
+	c := &Client{
 		hc: &http.Client{
 			Jar: jar,
 		},
+		endpoint:        apiEndpoint,
+		origin:          origin,
+		pageSize:        defaultPageSize,
+		pageConcurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.session = &session{jar: c.hc.Jar}
+	c.hc.Jar = c.session
+	c.transport = c.hc.Transport
+	c.applyMiddlewares()
+	return c
+}
+
+// downloadClient returns the http client of the file content, which shares the transport and the cookie jar
+// of the api client, but has no overall timeout and none of the middlewares, because the content is
+// streamed for a long time and may be large.
+func (c *Client) downloadClient() *http.Client {
+	return &http.Client{
+		Transport:     c.transport,
+		CheckRedirect: c.hc.CheckRedirect,
+		Jar:           c.session,
+	}
+}
+
+// do sends the request with the rate limiter and the retry policy of the client,
+// the response of a retryable http status or code of web api is converted to an error.
+func (c *Client) do(ctx context.Context, method, url string, params map[string]string, header map[string]string, body []byte) (*http.Response, error) {
+	var b backoff.BackOff = &backoff.StopBackOff{}
+	if c.retryPolicy != nil {
+		b = c.retryPolicy()
+	}
+	for {
+		if c.rateLimiter != nil {
+			if err := c.rateLimiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := c.send(ctx, method, url, params, header, body)
+		if err == nil {
+			if err = retryableStatus(resp); err == nil {
+				err = retryableCode(resp)
+			}
+			if err == nil {
+				return resp, nil
+			}
+			resp.Body.Close()
+		}
+		if ctx.Err() != nil || !IsRetryable(err) {
+			return nil, err
+		}
+		d := b.NextBackOff()
+		if d == backoff.Stop {
+			return nil, err
+		}
+		var rlErr *RateLimitError
+		if errors.As(err, &rlErr) && rlErr.RetryAfter > d {
+			d = rlErr.RetryAfter
+		}
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
 	}
 }
 
-func (c *Client) do(method, url string, params map[string]string, header map[string]string, body []byte) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+func (c *Client) send(ctx context.Context, method, url string, params map[string]string, header map[string]string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
 	for k, v := range header {
 		req.Header.Set(k, v)
 	}
 	if params != nil {
-		values := urlpkg.Values{}
+		values := req.URL.Query()
 		for k, v := range params {
 			values.Set(k, v)
 		}
@@ -90,136 +195,282 @@ func (c *Client) do(method, url string, params map[string]string, header map[str
 	return c.hc.Do(req)
 }
 
+// readResult reads the json response of web api, an error is returned for the unexpected http status
+// or the error code of web api.
+func readResult(resp *http.Response) (gjson.Result, error) {
+	if err := checkStatus(resp); err != nil {
+		return gjson.Result{}, err
+	}
+	b, err := ioutil.ReadAll(utfbom.SkipOnly(resp.Body))
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	result := gjson.ParseBytes(b)
+	if code := result.Get("code"); code.Exists() && code.Int() != codeOK {
+		return result, &APIError{Code: int(code.Int()), Message: result.Get("message").String()}
+	}
+	return result, nil
+}
+
+// Login posts the credentials to web api, the pubcookie of the new session is kept in the cookie jar,
+// use PubCookie to save it and SetCookies to restore it later.
 func (c *Client) Login(username, password string) error {
-	// TODO:
+	return c.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext is like Login but with a context.
+func (c *Client) LoginContext(ctx context.Context, username, password string) error {
+	url := fmt.Sprintf("%s%s", c.endpoint, "/login.php")
+	form := urlpkg.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+	resp, err := c.do(ctx, http.MethodPost, url, nil, map[string]string{
+		"Origin":       c.origin,
+		"Content-Type": "application/x-www-form-urlencoded",
+	}, []byte(form.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := readResult(resp); err != nil {
+		return err
+	}
+	if c.PubCookie() == "" {
+		return errors.New("no pubcookie in login response")
+	}
+	c.session.setLogin(true)
 	return nil
 }
 
 func (c *Client) Logout() error {
-	jar, _ := cookiejar.New(nil)
-	c.hc.Jar = jar
+	c.session.reset()
 	return nil
 }
 
-func (c *Client) SetCookies(pubCookie string) error {
-	u, err := urlpkg.Parse(apiEndpoint)
+// PubCookie returns the pubcookie of current session, or an empty string if there is no session.
+func (c *Client) PubCookie() string {
+	u, err := urlpkg.Parse(c.endpoint)
+	if err != nil {
+		return ""
+	}
+	for _, cookie := range c.session.Cookies(u) {
+		if cookie.Name == pubCookie {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// SetCookies restores a session by the pubcookie, the cookie is verified by fetching the account information.
+func (c *Client) SetCookies(cookie string) error {
+	return c.SetCookiesContext(context.Background(), cookie)
+}
+
+// SetCookiesContext is like SetCookies but with a context.
+func (c *Client) SetCookiesContext(ctx context.Context, cookie string) error {
+	u, err := urlpkg.Parse(c.endpoint)
 	if err != nil {
 		return err
 	}
-	// TODO: verify cookie
-	c.hc.Jar.SetCookies(u, []*http.Cookie{{Name: "pubcookie", Value: pubCookie}})
-	c.isLogin = true
+	c.session.SetCookies(u, []*http.Cookie{{Name: pubCookie, Value: cookie}})
+	if _, err := c.AccountContext(ctx); err != nil {
+		c.session.SetCookies(u, []*http.Cookie{{Name: pubCookie, MaxAge: -1}})
+		c.session.setLogin(false)
+		return err
+	}
+	c.session.setLogin(true)
 	return nil
 }
 
+// Account returns the information of the logged in account.
+func (c *Client) Account() (*Account, error) {
+	return c.AccountContext(context.Background())
+}
+
+// AccountContext is like Account but with a context.
+func (c *Client) AccountContext(ctx context.Context) (*Account, error) {
+	url := fmt.Sprintf("%s%s", c.endpoint, "/userinfo.php")
+	resp, err := c.do(ctx, http.MethodGet, url, nil, map[string]string{"Origin": c.origin}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	result, err := readResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	account := &Account{
+		UserID:     int(result.Get("userid").Int()),
+		Username:   result.Get("username").String(),
+		VIPLevel:   int(result.Get("vip_level").Int()),
+		DailyQuota: result.Get("traffic_limit").Int(),
+		DailyUsed:  result.Get("traffic_used").Int(),
+	}
+	if expire := result.Get("vip_expire").Int(); expire > 0 {
+		account.VIPExpiry = time.Unix(expire, 0)
+	}
+	return account, nil
+}
+
+// GetShareInfo returns the share information of the folder, shareID can be any form accepted by ParseLink,
+// and the folder ID of the link is used if folderID is empty.
 func (c *Client) GetShareInfo(shareID, folderID string) (*Share, error) {
-	url := fmt.Sprintf("%s%s", apiEndpoint, "/getdir.php")
+	return c.GetShareInfoContext(context.Background(), shareID, folderID)
+}
+
+// GetShareInfoContext is like GetShareInfo but with a context.
+func (c *Client) GetShareInfoContext(ctx context.Context, shareID, folderID string) (*Share, error) {
+	link, err := ParseLink(shareID)
+	if err != nil {
+		return nil, err
+	}
+	if link.Type != TypeFolder {
+		return nil, fmt.Errorf("not a folder share: %s", shareID)
+	}
+	if folderID == "" {
+		folderID = link.FolderID
+	}
+	key := cacheKey(link.ShareID, folderID)
+	if entry, fresh := c.cacheGet(key); fresh {
+		c.restorePasscode(link, entry)
+		return entry.Share, nil
+	}
+	var share *Share
+	err = c.withPasscode(ctx, link, func(passcode string) (err error) {
+		share, err = c.getShareInfo(ctx, link.ShareID, folderID, passcode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.cacheSet(key, &CacheEntry{Share: share, Passcode: c.passcode(link.ShareID), Updated: time.Now()})
+	return share, nil
+}
+
+func (c *Client) getShareInfo(ctx context.Context, shareID, folderID, passcode string) (*Share, error) {
+	url := fmt.Sprintf("%s%s", c.endpoint, "/getdir.php")
 	queries := map[string]string{
 		"folder_id": folderID,
+		"d":         shareID,
 	}
-	var passcode string
-	s := strings.SplitN(shareID, "@", 2)
-	if len(s) == 2 {
-		passcode = s[0]
-		queries["passcode"] = s[0]
-		queries["d"] = s[1]
+	if passcode != "" {
+		queries["passcode"] = passcode
 		queries["path"] = "d"
-	} else {
-		queries["d"] = shareID
 	}
-	resp, err := c.do(http.MethodGet, url, queries, map[string]string{"Origin": origin}, nil)
+	resp, err := c.do(ctx, http.MethodGet, url, queries, map[string]string{"Origin": c.origin}, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("StatusCode: %d", resp.StatusCode)
+	result, err := readResult(resp)
+	if err != nil {
+		return nil, err
 	}
 	share := new(Share)
-	if err := json.NewDecoder(utfbom.SkipOnly(resp.Body)).Decode(share); err != nil {
+	if err := json.Unmarshal([]byte(result.Raw), share); err != nil {
 		return nil, err
 	}
+	if share.Url == "" {
+		return nil, errors.New("no listing url in the share information")
+	}
 	if passcode != "" {
-		key := fmt.Sprintf("pass_d%d", share.FolderID)
-		exist := false
-		u, _ := urlpkg.Parse(apiEndpoint)
-		for _, item := range c.hc.Jar.Cookies(u) {
-			if item.Name == key {
-				exist = true
-				break
-			}
-		}
-		if !exist {
-			c.hc.Jar.SetCookies(u, append(c.hc.Jar.Cookies(u), &http.Cookie{Name: key, Value: passcode}))
-		}
+		c.setPasscodeCookie(share.FolderID, passcode)
 	}
 	return share, nil
 }
 
-func (c *Client) ParseFiles(share *Share) ([]*File, error) {
-	url := fmt.Sprintf("%s%s", apiEndpoint, share.Url)
-	resp, err := c.do(http.MethodGet, url, nil, map[string]string{"Origin": origin}, nil)
+// setPasscodeCookie sets the cookie of the passcode which is required by the listing of the folder.
+func (c *Client) setPasscodeCookie(folderID int, passcode string) {
+	key := fmt.Sprintf("pass_d%d", folderID)
+	u, _ := urlpkg.Parse(c.endpoint)
+	for _, item := range c.session.Cookies(u) {
+		if item.Name == key {
+			return
+		}
+	}
+	c.session.SetCookies(u, append(c.session.Cookies(u), &http.Cookie{Name: key, Value: passcode}))
+}
+
+// GetFileShareInfo returns the shared file of a single file share, shareID can be any form
+// accepted by ParseLink, the returned file can be passed to GetDownloadUrl.
+// A bare share ID is a shared file here, and a link of a shared folder is rejected.
+func (c *Client) GetFileShareInfo(shareID string) (*File, error) {
+	return c.GetFileShareInfoContext(context.Background(), shareID)
+}
+
+// GetFileShareInfoContext is like GetFileShareInfo but with a context.
+func (c *Client) GetFileShareInfoContext(ctx context.Context, shareID string) (*File, error) {
+	link, err := parseLink(shareID, TypeFile)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("StatusCode: %d", resp.StatusCode)
+	if link.Type != TypeFile {
+		return nil, fmt.Errorf("not a file share: %s", shareID)
 	}
-	b, err := ioutil.ReadAll(resp.Body)
+	var file *File
+	err = c.withPasscode(ctx, link, func(passcode string) (err error) {
+		file, err = c.getFileShareInfo(ctx, link.ShareID, passcode)
+		return err
+	})
+	return file, err
+}
+
+func (c *Client) getFileShareInfo(ctx context.Context, shareID, passcode string) (*File, error) {
+	url := fmt.Sprintf("%s%s", c.endpoint, "/getfile.php")
+	queries := map[string]string{
+		"f":    shareID,
+		"path": "f",
+	}
+	if passcode != "" {
+		queries["passcode"] = passcode
+	}
+	resp, err := c.do(ctx, http.MethodGet, url, queries, map[string]string{"Origin": c.origin}, nil)
 	if err != nil {
 		return nil, err
 	}
-	files := make([]*File, 0, 4)
-	data := gjson.ParseBytes(b)
-	data.Get("aaData").ForEach(func(_, value gjson.Result) bool {
-		item := value.Array()
-		file := &File{}
-		file.Name = utils.Match1(`<a.*?>(.*?)</a>`, item[1].String())
-		file.Size = item[2].String()
-		file.Date = item[3].String()
-		if utils.GetValueFromHTML(item[0].String(), "name") == "folder_ids[]" {
-			file.Type = TypeFolder
-		}
-		switch file.Type {
-		case TypeFile:
-			file.ID = strings.Replace(utils.GetValueFromHTML(item[1].String(), "href"), "/file/", "", 1)
-		case TypeFolder:
-			file.ID = utils.GetValueFromHTML(item[0].String(), "value")
-		}
-		files = append(files, file)
-		return true
-	})
-	return files, nil
+	defer resp.Body.Close()
+	result, err := readResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{
+		Type: TypeFile,
+		ID:   result.Get("file_id").String(),
+		Name: result.Get("file_name").String(),
+		Size: result.Get("file_size").String(),
+		Date: result.Get("file_time").String(),
+	}
+	if file.ID == "" {
+		file.ID = shareID
+	}
+	file.parseMeta()
+	return file, nil
 }
 
 func (c *Client) GetDownloadUrl(file *File) (map[string]string, error) {
+	return c.GetDownloadUrlContext(context.Background(), file)
+}
+
+// GetDownloadUrlContext is like GetDownloadUrl but with a context.
+func (c *Client) GetDownloadUrlContext(ctx context.Context, file *File) (map[string]string, error) {
 	if file.Type != TypeFile {
-		return nil, errors.New("this is not a file")
+		return nil, ErrNotFile
 	}
-	if !c.isLogin {
-		return nil, errors.New("not login")
+	if !c.session.loggedIn() {
+		return nil, ErrNotLoggedIn
 	}
-	url := fmt.Sprintf("%s%s", apiEndpoint, "/getfile.php")
-	resp, err := c.do(http.MethodGet, url,
+	url := fmt.Sprintf("%s%s", c.endpoint, "/getfile.php")
+	resp, err := c.do(ctx, http.MethodGet, url,
 		map[string]string{"f": file.ID},
-		map[string]string{"Origin": origin}, nil)
+		map[string]string{"Origin": c.origin}, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("StatusCode: %d", resp.StatusCode)
-	}
-	b, err := ioutil.ReadAll(resp.Body)
+	result, err := readResult(resp)
 	if err != nil {
 		return nil, err
 	}
-	result := gjson.ParseBytes(b)
-	code := result.Get("code").Int()
-	if code != 200 {
-		return nil, errors.New(result.Get("message").String())
-	}
 	reg := regexp.MustCompile(`vip_(\D*)_url`)
 	res := make(map[string]string)
 	result.ForEach(func(key, value gjson.Result) bool {
@@ -232,31 +483,3 @@ func (c *Client) GetDownloadUrl(file *File) (map[string]string, error) {
 	})
 	return res, nil
 }
-
-func (c *Client) walk(shareID, folderID, curPath string, handler func(curPath string, share *Share, file *File) bool) error {
-	share, err := c.GetShareInfo(shareID, folderID)
-	if err != nil {
-		return err
-	}
-	files, err := c.ParseFiles(share)
-	if err != nil {
-		return err
-	}
-	for _, file := range files {
-		switch file.Type {
-		case TypeFolder:
-			if err := c.walk(shareID, file.ID, path.Join(curPath, share.FolderName), handler); err != nil {
-				return err
-			}
-		case TypeFile:
-			if !handler(path.Join(curPath, share.FolderName), share, file) {
-				return ErrWalkAbort
-			}
-		}
-	}
-	return nil
-}
-
-func (c *Client) Walk(shareID, folderID string, handler func(curPath string, share *Share, file *File) bool) error {
-	return c.walk(shareID, folderID, "", handler)
-}
@@ -1 +1,363 @@
 package ctfile
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+)
+
+// newTestServer starts the fake server of newFakeServer and returns a client of it.
+func newTestServer() (*ctfiletest.Server, *Client) {
+	srv := newFakeServer()
+	return srv, NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL))
+}
+
+// newFakeServer starts a fake server with some users and the share tree:
+//
+//	root/
+//	├── a.txt
+//	├── sub/
+//	│   ├── b.txt
+//	│   └── deep/
+//	│       └── c.txt
+//	└── empty/
+func newFakeServer() *ctfiletest.Server {
+	srv := ctfiletest.NewServer()
+	srv.AddUser(&ctfiletest.User{
+		ID: 1, Username: "alice", Password: "secret",
+		VIPLevel: 2, VIPExpiry: time.Now().Add(time.Hour),
+		DailyQuota: 1024, DailyUsed: 512,
+	})
+	srv.AddUser(&ctfiletest.User{ID: 2, Username: "bob", Password: "secret"})
+	srv.AddUser(&ctfiletest.User{ID: 3, Username: "captcha", Password: "secret", CaptchaRequired: true})
+	srv.AddUser(&ctfiletest.User{ID: 4, Username: "locked", Password: "secret", Locked: true})
+	srv.AddShare(&ctfiletest.Share{
+		ID: "1-2-abc", UserID: 1, Username: "alice",
+		Root: &ctfiletest.Folder{
+			Name: "root", Time: "2019-12-01",
+			Files: []*ctfiletest.File{{Name: "a.txt", Date: "2019-12-01", Content: []byte("aaa")}},
+			Folders: []*ctfiletest.Folder{
+				{
+					Name: "sub", Time: "2019-12-02",
+					Files: []*ctfiletest.File{{Name: "b.txt", Date: "2019-12-02", Content: []byte("bbb")}},
+					Folders: []*ctfiletest.Folder{{
+						Name: "deep", Time: "2019-12-03",
+						Files: []*ctfiletest.File{{Name: "c.txt", Date: "2019-12-03", Content: []byte("ccc")}},
+					}},
+				},
+				{Name: "empty", Time: "2019-12-04"},
+			},
+		},
+	})
+	srv.AddShare(&ctfiletest.Share{
+		ID: "1-3-def", Passcode: "1234", UserID: 1, Username: "alice",
+		Root: &ctfiletest.Folder{
+			Name: "locked",
+			Files: []*ctfiletest.File{
+				{Name: "d.txt", Content: []byte("ddd")},
+			},
+		},
+	})
+	srv.AddFileShare(&ctfiletest.FileShare{
+		ID: "1-9-ghi", Passcode: "5678", UserID: 1, Username: "alice",
+		File: &ctfiletest.File{Name: "single.bin", Date: "2019-12-05", Content: []byte("single")},
+	})
+	return srv
+}
+
+func TestClient_Login(t *testing.T) {
+	tests := []struct {
+		username, password string
+		err                error
+	}{
+		{"alice", "secret", nil},
+		{"alice", "bad", ErrWrongPassword},
+		{"nobody", "secret", ErrWrongPassword},
+		{"captcha", "secret", ErrCaptchaRequired},
+		{"locked", "secret", ErrAccountLocked},
+	}
+	for _, test := range tests {
+		srv, c := newTestServer()
+		defer srv.Close()
+		if err := c.Login(test.username, test.password); !errors.Is(err, test.err) {
+			t.Errorf("Login(%q, %q) = %v, want %v", test.username, test.password, err, test.err)
+		}
+		if test.err != nil {
+			if c.session.loggedIn() || c.PubCookie() != "" {
+				t.Errorf("Login(%q, %q) failed but session exists", test.username, test.password)
+			}
+			continue
+		}
+		if !c.session.loggedIn() || c.PubCookie() == "" {
+			t.Errorf("Login(%q, %q) succeeded but session does not exist", test.username, test.password)
+		}
+	}
+}
+
+func TestClient_Logout(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if c.session.loggedIn() || c.PubCookie() != "" {
+		t.Error("session still exists after Logout")
+	}
+}
+
+func TestClient_Login_Concurrent(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	share, err := c.GetShareInfo("1-2-abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := c.ParseFiles(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the race detector reports the unsynchronized session state.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			c.Login("alice", "secret")
+		}()
+		go func() {
+			defer wg.Done()
+			c.GetDownloadUrl(files[2])
+		}()
+		go func() {
+			defer wg.Done()
+			c.Logout()
+		}()
+	}
+	wg.Wait()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetDownloadUrl(files[2]); err != nil {
+		t.Errorf("GetDownloadUrl() after the concurrent logins = %v", err)
+	}
+}
+
+func TestClient_SetCookies(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	if err := c.SetCookies("expired"); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("SetCookies(expired) = %v, want %v", err, ErrNotLoggedIn)
+	}
+	if c.session.loggedIn() || c.PubCookie() != "" {
+		t.Error("invalid cookie was kept")
+	}
+	cookie := srv.AddUser(&ctfiletest.User{ID: 5, Username: "carol"})
+	if err := c.SetCookies(cookie); err != nil {
+		t.Fatalf("SetCookies() = %v", err)
+	}
+	if !c.session.loggedIn() {
+		t.Error("isLogin is false after SetCookies")
+	}
+}
+
+func TestClient_Account(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	if _, err := c.Account(); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Account() without login = %v, want %v", err, ErrNotLoggedIn)
+	}
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	account, err := c.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.UserID != 1 || account.Username != "alice" || account.VIPLevel != 2 {
+		t.Errorf("unexpected account: %+v", account)
+	}
+	if !account.IsVIP() {
+		t.Error("IsVIP() = false, want true")
+	}
+	if account.QuotaExceeded() {
+		t.Error("QuotaExceeded() = true, want false")
+	}
+}
+
+func TestClient_GetShareInfo(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	share, err := c.GetShareInfo("1-2-abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.FolderName != "root" || share.UserID != 1 || share.Url == "" {
+		t.Errorf("unexpected share: %+v", share)
+	}
+	files, err := c.ParseFiles(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Name)
+	}
+	if want := []string{"sub", "empty", "a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFiles() = %v, want %v", got, want)
+	}
+	if files[0].Type != TypeFolder || files[2].Type != TypeFile || files[2].Size != "3 B" {
+		t.Errorf("unexpected files: %+v, %+v", files[0], files[2])
+	}
+	if files[2].SizeBytes != 3 || !files[2].ModTime.Equal(time.Date(2019, 12, 1, 0, 0, 0, 0, location)) {
+		t.Errorf("unexpected metadata: %d, %s", files[2].SizeBytes, files[2].ModTime)
+	}
+}
+
+func TestClient_GetShareInfo_Passcode(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	share, err := c.GetShareInfo("1234@1-3-def", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := c.ParseFiles(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "d.txt" {
+		t.Errorf("unexpected files: %v", files)
+	}
+}
+
+func TestClient_GetShareInfo_Link(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	for _, link := range []string{"https://545c.com/dir/1-3-def?1234", "https://url89.ctfile.com/d/1-3-def?p=1234"} {
+		share, err := c.GetShareInfo(link, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if share.FolderName != "locked" {
+			t.Errorf("GetShareInfo(%q) = %+v", link, share)
+		}
+	}
+	if _, err := c.GetShareInfo("https://545c.com/file/1-3-def", ""); err == nil {
+		t.Error("GetShareInfo() of a file link succeeded")
+	}
+}
+
+func TestClient_GetFileShareInfo(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	if _, err := c.GetFileShareInfo("https://545c.com/f/1-9-ghi"); err == nil {
+		t.Error("GetFileShareInfo() without passcode succeeded")
+	}
+	if _, err := c.GetFileShareInfo("https://545c.com/f/1-9-ghi?p=0000"); !errors.Is(err, ErrWrongPasscode) {
+		t.Errorf("GetFileShareInfo() with wrong passcode = %v, want %v", err, ErrWrongPasscode)
+	}
+	file, err := c.GetFileShareInfo("https://545c.com/f/1-9-ghi?p=5678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Type != TypeFile || file.Name != "single.bin" || file.SizeBytes != 6 {
+		t.Errorf("unexpected file: %+v", file)
+	}
+	if got, err := c.GetFileShareInfo("5678@1-9-ghi"); err != nil || got.Name != "single.bin" {
+		t.Errorf("GetFileShareInfo() of a bare share id = %+v, %v", got, err)
+	}
+	if _, err := c.GetFileShareInfo("https://545c.com/d/1-9-ghi?p=5678"); err == nil {
+		t.Error("GetFileShareInfo() of a folder link succeeded")
+	}
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	urls, err := c.GetDownloadUrl(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) == 0 {
+		t.Error("GetDownloadUrl() returned no url")
+	}
+}
+
+func TestClient_GetDownloadUrl(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	share, err := c.GetShareInfo("1-2-abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := c.ParseFiles(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := files[2]
+	if _, err := c.GetDownloadUrl(file); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("GetDownloadUrl() without login = %v, want %v", err, ErrNotLoggedIn)
+	}
+	if _, err := c.GetDownloadUrl(files[0]); !errors.Is(err, ErrNotFile) {
+		t.Errorf("GetDownloadUrl() of a folder = %v, want %v", err, ErrNotFile)
+	}
+	if err := c.Login("bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetDownloadUrl(file); !errors.Is(err, ErrNotVIP) {
+		t.Errorf("GetDownloadUrl() by a normal user = %v, want %v", err, ErrNotVIP)
+	}
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	urls, err := c.GetDownloadUrl(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 3 {
+		t.Errorf("GetDownloadUrl() = %v, want 3 mirrors", urls)
+	}
+	resp, err := http.Get(urls["dx"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != 3 {
+		t.Errorf("unexpected download response: %d, %d", resp.StatusCode, resp.ContentLength)
+	}
+}
+
+func TestNewClient_Options(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/userinfo.php", func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		time.Sleep(100 * time.Millisecond)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient(
+		WithAPIEndpoint(srv.URL+"/"),
+		WithOrigin("https://example.com"),
+		WithHTTPClient(&http.Client{}),
+		WithUserAgent("ctfile-test"),
+		WithTimeout(20*time.Millisecond),
+	)
+	if c.hc.Jar == nil {
+		t.Fatal("cookie jar is nil")
+	}
+	if _, err := c.Account(); err == nil {
+		t.Error("Account() = nil, want timeout error")
+	}
+	header := <-headers
+	if ua, origin := header.Get("User-Agent"), header.Get("Origin"); ua != "ctfile-test" || origin != "https://example.com" {
+		t.Errorf("unexpected request headers, User-Agent: %q, Origin: %q", ua, origin)
+	}
+}
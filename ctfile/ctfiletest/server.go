@@ -0,0 +1,624 @@
+// Package ctfiletest provides an in-process fake of the ctfile web api for tests.
+package ctfiletest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// codes of web api response.
+const (
+	CodeOK               = 200
+	CodeNotLogin         = 401
+	CodeNotVIP           = 402
+	CodeWrongPasscode    = 403
+	CodeNotFound         = 404
+	CodePasscodeRequired = 405
+	CodeRateLimited      = 429
+	CodeQuotaExceeded    = 509
+	CodeWrongPassword    = 1001
+	CodeCaptchaRequired  = 1002
+	CodeAccountLocked    = 1003
+)
+
+type User struct {
+	ID       int
+	Username string
+	Password string
+	// VIPLevel is 0 for the normal user.
+	VIPLevel  int
+	VIPExpiry time.Time
+	// DailyQuota and DailyUsed are the download traffic of today in bytes, zero DailyQuota means unlimited.
+	DailyQuota int64
+	DailyUsed  int64
+	// CaptchaRequired and Locked make the login of this user fail.
+	CaptchaRequired bool
+	Locked          bool
+}
+
+func (u *User) isVIP() bool {
+	return u.VIPLevel > 0 && time.Now().Before(u.VIPExpiry)
+}
+
+type File struct {
+	// ID is generated by AddShare if empty.
+	ID   string
+	Name string
+	// Size is formatted from the length of Content if empty.
+	Size    string
+	Date    string
+	Content []byte
+}
+
+type Folder struct {
+	// ID is generated by AddShare if zero.
+	ID      int
+	Name    string
+	Time    string
+	Folders []*Folder
+	Files   []*File
+}
+
+type Share struct {
+	ID       string
+	Passcode string
+	UserID   int
+	Username string
+	Root     *Folder
+}
+
+// FileShare is a share of a single file.
+type FileShare struct {
+	ID       string
+	Passcode string
+	UserID   int
+	Username string
+	// File.ID is the share ID if empty.
+	File *File
+}
+
+type folderRef struct {
+	share  *Share
+	folder *Folder
+}
+
+// Server is a fake of ctfile web api, it's safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	latency  time.Duration
+	pageSize int
+	noShare  bool
+	limited  int
+	retry    time.Duration
+	inBody   bool
+	failures int
+	failCode int
+	linkTTL  time.Duration
+	down     map[string]bool
+	requests int
+	nextID   int
+	users    map[string]*User
+	sessions map[string]*User
+	shares   map[string]*Share
+	fshares  map[string]*FileShare
+	folders  map[int]*folderRef
+	files    map[string]*File
+}
+
+// NewServer starts and returns a new Server, the caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		nextID:   1000,
+		users:    make(map[string]*User),
+		sessions: make(map[string]*User),
+		shares:   make(map[string]*Share),
+		fshares:  make(map[string]*FileShare),
+		down:     make(map[string]bool),
+		folders:  make(map[int]*folderRef),
+		files:    make(map[string]*File),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login.php", s.api(s.handleLogin))
+	mux.HandleFunc("/userinfo.php", s.api(s.handleUserInfo))
+	mux.HandleFunc("/getdir.php", s.api(s.handleGetDir))
+	mux.HandleFunc("/iajax_guest.php", s.api(s.handleFileList))
+	mux.HandleFunc("/getfile.php", s.api(s.handleGetFile))
+	mux.HandleFunc("/download/", s.handleDownload)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddUser registers an user and returns a valid pubcookie of it.
+func (s *Server) AddUser(user *User) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.Username] = user
+	return s.newSession(user)
+}
+
+// AddShare registers a share tree, missing IDs of folders and files are generated.
+func (s *Server) AddShare(share *Share) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shares[share.ID] = share
+	s.addFolder(share, share.Root)
+}
+
+// AddFileShare registers a share of a single file.
+func (s *Server) AddFileShare(share *FileShare) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if share.File.ID == "" {
+		share.File.ID = share.ID
+	}
+	if share.File.Size == "" {
+		share.File.Size = FormatSize(int64(len(share.File.Content)))
+	}
+	s.fshares[share.ID] = share
+	s.files[share.File.ID] = share.File
+}
+
+// AddFile adds a file to the folder of a registered share, which changes the ETag of the listing.
+func (s *Server) AddFile(folderID int, file *File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref := s.folders[folderID]
+	ref.folder.Files = append(ref.folder.Files, file)
+	s.addFile(ref.share, file)
+}
+
+func (s *Server) addFolder(share *Share, folder *Folder) {
+	if folder.ID == 0 {
+		folder.ID = s.genID()
+	}
+	s.folders[folder.ID] = &folderRef{share: share, folder: folder}
+	for _, file := range folder.Files {
+		s.addFile(share, file)
+	}
+	for _, sub := range folder.Folders {
+		s.addFolder(share, sub)
+	}
+}
+
+func (s *Server) addFile(share *Share, file *File) {
+	if file.ID == "" {
+		file.ID = fmt.Sprintf("%d-%d", share.UserID, s.genID())
+	}
+	if file.Size == "" {
+		file.Size = FormatSize(int64(len(file.Content)))
+	}
+	s.files[file.ID] = file
+}
+
+func (s *Server) genID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// SetLatency delays every api response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetPageSize sets the max count of files in a page of the folder listing, zero means unlimited.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// SetListingWithoutShare omits the share ID from the listing url of the share information,
+// the listing is looked up by the folder ID only.
+func (s *Server) SetListingWithoutShare(omit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noShare = omit
+}
+
+// RateLimit makes the next n api requests fail with http status 429 and the Retry-After header.
+func (s *Server) RateLimit(n int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limited = n
+	s.retry = retryAfter
+	s.inBody = false
+}
+
+// RateLimitInBody makes the next n api requests fail with the code 429 of web api in a response of http status 200.
+func (s *Server) RateLimitInBody(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limited = n
+	s.retry = 0
+	s.inBody = true
+}
+
+// Fail makes the next n api requests fail with the http status, e.g. http.StatusBadGateway.
+func (s *Server) Fail(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+	s.failCode = status
+}
+
+// SetLinkTTL makes the download urls expire after d, the expired url responds http status 403.
+// Zero means the urls never expire.
+func (s *Server) SetLinkTTL(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.linkTTL = d
+}
+
+// SetMirrorDown makes the download urls of the mirror, e.g. "dx", respond http status 503.
+func (s *Server) SetMirrorDown(mirror string, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down[mirror] = down
+}
+
+// Requests returns the count of api requests served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) newSession(user *User) string {
+	cookie := fmt.Sprintf("session-%d-%d", user.ID, s.genID())
+	s.sessions[cookie] = user
+	return cookie
+}
+
+// user returns the logged in user of the request, must be called with s.mu held.
+func (s *Server) user(r *http.Request) *User {
+	cookie, err := r.Cookie("pubcookie")
+	if err != nil {
+		return nil
+	}
+	return s.sessions[cookie.Value]
+}
+
+func (s *Server) api(handler func(w http.ResponseWriter, r *http.Request) (int, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		latency := s.latency
+		limited := s.limited > 0
+		if limited {
+			s.limited--
+		}
+		retry, inBody := s.retry, s.inBody
+		failCode := 0
+		if !limited && s.failures > 0 {
+			s.failures--
+			failCode = s.failCode
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if limited && inBody {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSON(w, result(CodeRateLimited, "请求过于频繁，请稍后再试"))
+			return
+		}
+		if limited {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry/time.Second)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			writeJSON(w, result(CodeRateLimited, "请求过于频繁，请稍后再试"))
+			return
+		}
+		if failCode != 0 {
+			http.Error(w, http.StatusText(failCode), failCode)
+			return
+		}
+		s.mu.Lock()
+		status, body := handler(w, r)
+		s.mu.Unlock()
+		if status == http.StatusNotModified {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		writeJSON(w, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	json.NewEncoder(w).Encode(v)
+}
+
+func result(code int, message string) map[string]interface{} {
+	return map[string]interface{}{"code": code, "message": message}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, result(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	user, ok := s.users[r.PostFormValue("username")]
+	switch {
+	case !ok || user.Password != r.PostFormValue("password"):
+		return http.StatusOK, result(CodeWrongPassword, "用户名或密码错误")
+	case user.Locked:
+		return http.StatusOK, result(CodeAccountLocked, "账号已被锁定")
+	case user.CaptchaRequired:
+		return http.StatusOK, result(CodeCaptchaRequired, "请输入验证码")
+	}
+	http.SetCookie(w, &http.Cookie{Name: "pubcookie", Value: s.newSession(user), Path: "/"})
+	return http.StatusOK, result(CodeOK, "登录成功")
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	user := s.user(r)
+	if user == nil {
+		return http.StatusOK, result(CodeNotLogin, "请先登录")
+	}
+	var expire int64
+	if !user.VIPExpiry.IsZero() {
+		expire = user.VIPExpiry.Unix()
+	}
+	return http.StatusOK, map[string]interface{}{
+		"code":          CodeOK,
+		"userid":        user.ID,
+		"username":      user.Username,
+		"vip_level":     user.VIPLevel,
+		"vip_expire":    expire,
+		"traffic_limit": user.DailyQuota,
+		"traffic_used":  user.DailyUsed,
+	}
+}
+
+// checkPasscode reports the result code of the passcode check of the folder.
+func checkPasscode(r *http.Request, ref *folderRef, passcode string) int {
+	if ref.share.Passcode == "" {
+		return CodeOK
+	}
+	if passcode == "" {
+		if cookie, err := r.Cookie(fmt.Sprintf("pass_d%d", ref.folder.ID)); err == nil {
+			passcode = cookie.Value
+		}
+	}
+	switch passcode {
+	case "":
+		return CodePasscodeRequired
+	case ref.share.Passcode:
+		return CodeOK
+	default:
+		return CodeWrongPasscode
+	}
+}
+
+func (s *Server) lookupFolder(shareID, folderID string) (*folderRef, bool) {
+	share, ok := s.shares[shareID]
+	if !ok {
+		return nil, false
+	}
+	if folderID == "" {
+		return s.folders[share.Root.ID], true
+	}
+	id, err := strconv.Atoi(folderID)
+	if err != nil {
+		return nil, false
+	}
+	ref, ok := s.folders[id]
+	if !ok || ref.share != share {
+		return nil, false
+	}
+	return ref, true
+}
+
+func (s *Server) handleGetDir(w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	q := r.URL.Query()
+	ref, ok := s.lookupFolder(q.Get("d"), q.Get("folder_id"))
+	if !ok {
+		return http.StatusOK, result(CodeNotFound, "文件不存在或已删除")
+	}
+	switch code := checkPasscode(r, ref, q.Get("passcode")); code {
+	case CodePasscodeRequired:
+		return http.StatusOK, result(code, "请输入访问密码")
+	case CodeWrongPasscode:
+		return http.StatusOK, result(code, "访问密码错误")
+	}
+	url := fmt.Sprintf("/iajax_guest.php?item=file_act&action=file_list&d=%s&folder_id=%d", ref.share.ID, ref.folder.ID)
+	if s.noShare {
+		url = fmt.Sprintf("/iajax_guest.php?item=file_act&action=file_list&folder_id=%d", ref.folder.ID)
+	}
+	return http.StatusOK, map[string]interface{}{
+		"code":        CodeOK,
+		"userid":      ref.share.UserID,
+		"folder_id":   ref.folder.ID,
+		"file_chk":    fmt.Sprintf("chk%d", ref.folder.ID),
+		"folder_name": ref.folder.Name,
+		"folder_time": ref.folder.Time,
+		"username":    ref.share.Username,
+		"email":       ref.share.Username + "@example.com",
+		"url":         url,
+		"page_title":  ref.folder.Name,
+	}
+}
+
+func (s *Server) handleFileList(w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	q := r.URL.Query()
+	var (
+		ref *folderRef
+		ok  bool
+	)
+	if q.Get("d") == "" {
+		id, _ := strconv.Atoi(q.Get("folder_id"))
+		ref, ok = s.folders[id]
+	} else {
+		ref, ok = s.lookupFolder(q.Get("d"), q.Get("folder_id"))
+	}
+	if !ok || q.Get("folder_id") == "" {
+		return http.StatusOK, result(CodeNotFound, "文件不存在或已删除")
+	}
+	if checkPasscode(r, ref, "") != CodeOK {
+		return http.StatusOK, result(CodePasscodeRequired, "请输入访问密码")
+	}
+	rows := make([][]string, 0, len(ref.folder.Folders)+len(ref.folder.Files))
+	for _, folder := range ref.folder.Folders {
+		rows = append(rows, []string{
+			fmt.Sprintf(`<input type="checkbox" name="folder_ids[]" value="%d">`, folder.ID),
+			fmt.Sprintf(`<a href="javascript:void(0)" onclick="load_subdir(%d)">%s</a>`,
+				folder.ID, html.EscapeString(folder.Name)),
+			"- -",
+			folder.Time,
+		})
+	}
+	for _, file := range ref.folder.Files {
+		rows = append(rows, []string{
+			fmt.Sprintf(`<input type="checkbox" name="file_ids[]" value="%s">`, file.ID),
+			fmt.Sprintf(`<a href="/file/%s" target="_blank">%s</a>`, file.ID, html.EscapeString(file.Name)),
+			file.Size,
+			file.Date,
+		})
+	}
+	// the ETag covers the whole listing, so it's the same for every page.
+	h := sha1.New()
+	json.NewEncoder(h).Encode(rows)
+	etag := fmt.Sprintf(`"%x"`, h.Sum(nil))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		return http.StatusNotModified, nil
+	}
+	total := len(rows)
+	start, _ := strconv.Atoi(q.Get("iDisplayStart"))
+	length, err := strconv.Atoi(q.Get("iDisplayLength"))
+	if err != nil || length <= 0 || (s.pageSize > 0 && length > s.pageSize) {
+		length = s.pageSize
+	}
+	if start < 0 || start > total {
+		start = total
+	}
+	rows = rows[start:]
+	if length > 0 && length < len(rows) {
+		rows = rows[:length]
+	}
+	return http.StatusOK, map[string]interface{}{
+		"sEcho":                1,
+		"iTotalRecords":        total,
+		"iTotalDisplayRecords": total,
+		"aaData":               rows,
+	}
+}
+
+// handleGetFile returns the download urls of the file, or the information of the file share
+// if the query "path" is "f", the download urls of which are only returned to a VIP.
+func (s *Server) handleGetFile(w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	q := r.URL.Query()
+	if q.Get("path") == "f" {
+		return s.handleFileShare(w, r)
+	}
+	file, ok := s.files[q.Get("f")]
+	if !ok {
+		return http.StatusOK, result(CodeNotFound, "文件不存在或已删除")
+	}
+	user := s.user(r)
+	switch {
+	case user == nil:
+		return http.StatusOK, result(CodeNotLogin, "请先登录")
+	case !user.isVIP():
+		return http.StatusOK, result(CodeNotVIP, "仅限VIP会员下载")
+	case user.DailyQuota > 0 && user.DailyUsed >= user.DailyQuota:
+		return http.StatusOK, result(CodeQuotaExceeded, "今日下载流量已用完")
+	}
+	return http.StatusOK, s.fileResult(file, true)
+}
+
+func (s *Server) handleFileShare(w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	q := r.URL.Query()
+	share, ok := s.fshares[q.Get("f")]
+	if !ok {
+		return http.StatusOK, result(CodeNotFound, "文件不存在或已删除")
+	}
+	if share.Passcode != "" {
+		switch q.Get("passcode") {
+		case "":
+			return http.StatusOK, result(CodePasscodeRequired, "请输入访问密码")
+		case share.Passcode:
+		default:
+			return http.StatusOK, result(CodeWrongPasscode, "访问密码错误")
+		}
+	}
+	user := s.user(r)
+	res := s.fileResult(share.File, user != nil && user.isVIP())
+	res["userid"] = share.UserID
+	res["username"] = share.Username
+	return http.StatusOK, res
+}
+
+func (s *Server) fileResult(file *File, withUrls bool) map[string]interface{} {
+	res := map[string]interface{}{
+		"code":      CodeOK,
+		"file_id":   file.ID,
+		"file_name": file.Name,
+		"file_size": file.Size,
+		"file_time": file.Date,
+	}
+	if withUrls {
+		for _, mirror := range []string{"dx", "lt", "yd"} {
+			url := fmt.Sprintf("%s/download/%s?mirror=%s", s.URL, file.ID, mirror)
+			if s.linkTTL > 0 {
+				url += fmt.Sprintf("&expires=%d", time.Now().Add(s.linkTTL).UnixNano())
+			}
+			res[fmt.Sprintf("vip_%s_url", mirror)] = url
+		}
+	}
+	return res
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	file, ok := s.files[strings.TrimPrefix(r.URL.Path, "/download/")]
+	down := s.down[r.URL.Query().Get("mirror")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if down {
+		http.Error(w, "mirror is down", http.StatusServiceUnavailable)
+		return
+	}
+	if expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64); err == nil && time.Now().UnixNano() > expires {
+		http.Error(w, "link is expired", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
+	http.ServeContent(w, r, file.Name, time.Time{}, bytes.NewReader(file.Content))
+}
+
+// FormatSize formats the size like the web page of ctfile, e.g. "1.23 MB".
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	f, i := float64(size), 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.2f %s", f, units[i])
+}
@@ -0,0 +1,134 @@
+package ctfile
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrWalkAbort        = errors.New("walk abort")
+	ErrNotFile          = errors.New("this is not a file")
+	ErrNotLoggedIn      = errors.New("not login")
+	ErrWrongPassword    = errors.New("wrong username or password")
+	ErrCaptchaRequired  = errors.New("captcha required")
+	ErrAccountLocked    = errors.New("account locked")
+	ErrWrongPasscode    = errors.New("wrong passcode")
+	ErrPasscodeRequired = errors.New("passcode required")
+	ErrShareNotFound    = errors.New("share not found")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrQuotaExceeded    = errors.New("daily traffic quota exceeded")
+	ErrNotVIP           = errors.New("not a vip")
+)
+
+// codes of web api response.
+const (
+	codeOK               = 200
+	codeNotLogin         = 401
+	codeNotVIP           = 402
+	codeWrongPasscode    = 403
+	codeNotFound         = 404
+	codePasscodeRequired = 405
+	codeRateLimited      = 429
+	codeQuotaExceeded    = 509
+	codeWrongPassword    = 1001
+	codeCaptchaRequired  = 1002
+	codeAccountLocked    = 1003
+)
+
+var codeErrors = map[int]error{
+	codeNotLogin:         ErrNotLoggedIn,
+	codeNotVIP:           ErrNotVIP,
+	codeWrongPasscode:    ErrWrongPasscode,
+	codeNotFound:         ErrShareNotFound,
+	codePasscodeRequired: ErrPasscodeRequired,
+	codeRateLimited:      ErrRateLimited,
+	codeQuotaExceeded:    ErrQuotaExceeded,
+	codeWrongPassword:    ErrWrongPassword,
+	codeCaptchaRequired:  ErrCaptchaRequired,
+	codeAccountLocked:    ErrAccountLocked,
+}
+
+// APIError is an error code returned by web api, it wraps the matching sentinel error like ErrNotVIP,
+// so both errors.Is and errors.As work with it.
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (code: %d)", e.Message, e.Code)
+}
+
+func (e *APIError) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+// StatusError is returned when web api responds an unexpected http status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("StatusCode: %d", e.StatusCode)
+}
+
+// RateLimitError is returned when web api responds http status 429, errors.Is(err, ErrRateLimited) reports true for it.
+type RateLimitError struct {
+	// RetryAfter is the duration to wait before the next request, zero if the server does not tell.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// ParseError is returned when a row of the folder listing can not be parsed.
+type ParseError struct {
+	// Row is the index of the row in the page.
+	Row int
+	// Raw is the json of the row.
+	Raw     string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid row %d of listing: %s", e.Row, e.Message)
+}
+
+// checkStatus returns an error if the http status of the response is not 200.
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	default:
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+}
+
+// parseRetryAfter parses the Retry-After header, which is either seconds or a http date.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(s); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
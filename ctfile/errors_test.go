@@ -0,0 +1,66 @@
+package ctfile
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+)
+
+func TestAPIError(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	_, err := c.GetShareInfo("not-exist", "")
+	if !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("GetShareInfo() = %v, want %v", err, ErrShareNotFound)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != codeNotFound || apiErr.Message == "" {
+		t.Errorf("GetShareInfo() = %#v, want an *APIError", err)
+	}
+
+	srv.AddUser(&ctfiletest.User{
+		ID: 6, Username: "dave", Password: "secret",
+		VIPLevel: 1, VIPExpiry: time.Now().Add(time.Hour),
+		DailyQuota: 1, DailyUsed: 1,
+	})
+	if err := c.Login("dave", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := c.GetFileShareInfo("5678@1-9-ghi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetDownloadUrl(file); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("GetDownloadUrl() = %v, want %v", err, ErrQuotaExceeded)
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	srv.RateLimit(1, 3*time.Second)
+	_, err := c.GetShareInfo("1-2-abc", "")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("GetShareInfo() = %v, want %v", err, ErrRateLimited)
+	}
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) || rlErr.RetryAfter != 3*time.Second {
+		t.Errorf("GetShareInfo() = %#v, want a *RateLimitError retry after 3s", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("120"); d != 2*time.Minute {
+		t.Errorf("parseRetryAfter(120) = %s", d)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("parseRetryAfter(%s) = %s", date, d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("parseRetryAfter(soon) = %s", d)
+	}
+}
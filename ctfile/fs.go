@@ -0,0 +1,319 @@
+package ctfile
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShareFS is a read-only file system over a folder share, it implements fs.FS, fs.ReadDirFS and fs.StatFS.
+// Listings are fetched on demand and kept for the life of the ShareFS, and the content of files
+// is downloaded through the VIP download url, so reading a file requires a logged in VIP account.
+type ShareFS struct {
+	c        *Client
+	ctx      context.Context
+	shareID  string
+	folderID string
+
+	mu        sync.Mutex
+	root      *File
+	rootShare *Share
+	listings  map[string][]*File
+}
+
+// FS returns the file system of the share rooted at the folder, shareID can be any form accepted by ParseLink,
+// and the folder ID of the link is used if folderID is empty.
+func (c *Client) FS(shareID, folderID string) *ShareFS {
+	return c.FSContext(context.Background(), shareID, folderID)
+}
+
+// FSContext is like FS but with a context, which is used by all requests of the file system.
+func (c *Client) FSContext(ctx context.Context, shareID, folderID string) *ShareFS {
+	return &ShareFS{
+		c:        c,
+		ctx:      ctx,
+		shareID:  shareID,
+		folderID: folderID,
+		listings: make(map[string][]*File),
+	}
+}
+
+// Open opens the file or folder of the name, the opened file is also an io.Seeker,
+// and its content is downloaded by Client.Open on the first Read or Seek.
+func (s *ShareFS) Open(name string) (fs.File, error) {
+	file, err := s.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := newFileInfo(name, file)
+	if file.Type == TypeFolder {
+		return &shareDir{fs: s, info: info, file: file}, nil
+	}
+	return &shareFile{fs: s, info: info, file: file}, nil
+}
+
+// ReadDir reads the folder of the name and returns its entries sorted by name.
+func (s *ShareFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := s.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if file.Type != TypeFolder {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return s.readDir(name, file)
+}
+
+// Stat returns the fs.FileInfo of the file or folder of the name, the *File is returned by its Sys method.
+func (s *ShareFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := s.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(name, file), nil
+}
+
+func (s *ShareFS) readDir(name string, folder *File) ([]fs.DirEntry, error) {
+	files, err := s.list(folder)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(files))
+	for _, file := range files {
+		entries = append(entries, newFileInfo(file.Name, file))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// lookup returns the file or folder of the name by listing the folders in the path.
+func (s *ShareFS) lookup(op, name string) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := s.rootFolder()
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if name == "." {
+		return file, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if file.Type != TypeFolder {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		files, err := s.list(file)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		file = nil
+		for _, f := range files {
+			if f.Name == elem {
+				file = f
+				break
+			}
+		}
+		if file == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return file, nil
+}
+
+func (s *ShareFS) rootFolder() (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.root != nil {
+		return s.root, nil
+	}
+	share, err := s.c.GetShareInfoContext(s.ctx, s.shareID, s.folderID)
+	if err != nil {
+		return nil, err
+	}
+	root := &File{Type: TypeFolder, ID: s.folderID}
+	rootEntry(share, root)
+	s.root, s.rootShare = root, share
+	return root, nil
+}
+
+// list returns the listing of the folder, the listing is fetched only once.
+func (s *ShareFS) list(folder *File) ([]*File, error) {
+	s.mu.Lock()
+	files, ok := s.listings[folder.ID]
+	share := s.rootShare
+	s.mu.Unlock()
+	if ok {
+		return files, nil
+	}
+	if folder != s.root {
+		var err error
+		if share, err = s.c.GetShareInfoContext(s.ctx, s.shareID, folder.ID); err != nil {
+			return nil, err
+		}
+	}
+	files, err := s.c.ParseFilesContext(s.ctx, share)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.listings[folder.ID] = files
+	s.mu.Unlock()
+	return files, nil
+}
+
+// fileInfo implements both fs.FileInfo and fs.DirEntry.
+type fileInfo struct {
+	name string
+	file *File
+}
+
+func newFileInfo(name string, file *File) *fileInfo {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return &fileInfo{name: name, file: file}
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+// Size is approximate because the size in the listing is rounded, see File.SizeBytes.
+func (fi *fileInfo) Size() int64 {
+	if fi.file.Type == TypeFolder {
+		return 0
+	}
+	return fi.file.SizeBytes
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.file.Type == TypeFolder {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.file.ModTime
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.file.Type == TypeFolder
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return fi.file
+}
+
+func (fi *fileInfo) Type() fs.FileMode {
+	return fi.Mode().Type()
+}
+
+func (fi *fileInfo) Info() (fs.FileInfo, error) {
+	return fi, nil
+}
+
+// shareDir is an opened folder of ShareFS.
+type shareDir struct {
+	fs      *ShareFS
+	info    *fileInfo
+	file    *File
+	entries []fs.DirEntry
+	offset  int
+	read    bool
+}
+
+func (d *shareDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *shareDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *shareDir) Close() error {
+	return nil
+}
+
+func (d *shareDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.readDir(d.info.name, d.file)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+// shareFile is an opened file of ShareFS, the reader of Client.Open is opened on the first Read or Seek.
+type shareFile struct {
+	fs     *ShareFS
+	info   *fileInfo
+	file   *File
+	r      io.ReadSeekCloser
+	closed bool
+}
+
+func (f *shareFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *shareFile) reader(op string) (io.ReadSeekCloser, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: op, Path: f.info.name, Err: fs.ErrClosed}
+	}
+	if f.r == nil {
+		r, err := f.fs.c.OpenContext(f.fs.ctx, f.file)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: f.info.name, Err: err}
+		}
+		f.r = r
+	}
+	return f.r, nil
+}
+
+func (f *shareFile) Read(p []byte) (int, error) {
+	r, err := f.reader("read")
+	if err != nil {
+		return 0, err
+	}
+	return r.Read(p)
+}
+
+func (f *shareFile) Seek(offset int64, whence int) (int64, error) {
+	r, err := f.reader("seek")
+	if err != nil {
+		return 0, err
+	}
+	return r.Seek(offset, whence)
+}
+
+func (f *shareFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.info.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.r != nil {
+		return f.r.Close()
+	}
+	return nil
+}
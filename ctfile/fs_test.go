@@ -0,0 +1,93 @@
+package ctfile
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestShareFS(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	fsys := c.FS("1-2-abc", "")
+	if err := fstest.TestFS(fsys, "a.txt", "sub/b.txt", "sub/deep/c.txt", "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "a.txt", "empty", "sub", "sub/b.txt", "sub/deep", "sub/deep/c.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("WalkDir() visited %v, want %v", paths, want)
+	}
+
+	matches, err := fs.Glob(fsys, "sub/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sub/b.txt"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("Glob() = %v, want %v", matches, want)
+	}
+
+	b, err := fs.ReadFile(fsys, "sub/deep/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ccc" {
+		t.Errorf("ReadFile() = %q, want %q", b, "ccc")
+	}
+
+	info, err := fs.Stat(fsys, "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Sys().(*File).Type != TypeFolder {
+		t.Errorf("unexpected info of folder: %+v", info)
+	}
+}
+
+func TestShareFS_Error(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	fsys := c.FS("1-2-abc", "")
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"missing.txt", fs.ErrNotExist},
+		{"a.txt/child", fs.ErrNotExist},
+		{"/a.txt", fs.ErrInvalid},
+		{"sub/../a.txt", fs.ErrInvalid},
+	}
+	for _, test := range tests {
+		if _, err := fsys.Open(test.name); !errors.Is(err, test.err) {
+			t.Errorf("Open(%q) = %v, want %v", test.name, err, test.err)
+		}
+	}
+	if _, err := fsys.ReadDir("a.txt"); err == nil {
+		t.Error("ReadDir() of a file succeeded")
+	}
+
+	// reading a file requires a login.
+	if _, err := fs.ReadFile(fsys, "a.txt"); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("ReadFile() without login = %v, want %v", err, ErrNotLoggedIn)
+	}
+
+	if _, err := c.FS("1-0-missing", "").Stat("."); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Stat() of a missing share = %v, want %v", err, ErrShareNotFound)
+	}
+}
@@ -0,0 +1,102 @@
+package ctfile
+
+import (
+	"fmt"
+	urlpkg "net/url"
+	"regexp"
+	"strings"
+)
+
+// Link is a reference to a shared folder or a shared file.
+type Link struct {
+	// Type is TypeFolder for the shared folder and TypeFile for the shared file.
+	Type     Type
+	ShareID  string
+	FolderID string
+	Passcode string
+}
+
+var (
+	hostRegexp     = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+(:[0-9]+)?/`)
+	numericRegexp  = regexp.MustCompile(`^[0-9]+$`)
+	passcodeParams = []string{"p", "pwd", "passcode", "pass"}
+)
+
+// ParseLink parses the share reference in any of these forms:
+//
+//	1234@14332434-27583520-ec5ff3
+//	https://545c.com/dir/14332434-27583520-ec5ff3?1234
+//	https://545c.com/dir/14332434-27583520-ec5ff3/33283567/
+//	https://url89.ctfile.com/d/14332434-27583520-ec5ff3?p=1234
+//	https://545c.com/file/14332434-424853530
+//	url89.ctfile.com/f/14332434-424853530-8a9c4e?pwd=1234
+//
+// The host of the url is ignored because the service changes its domains frequently.
+// A bare share ID without the url is a shared folder.
+func ParseLink(s string) (*Link, error) {
+	return parseLink(s, TypeFolder)
+}
+
+// parseLink is like ParseLink but a bare share ID is of the given type.
+func parseLink(s string, typ Type) (*Link, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty link")
+	}
+	if !strings.Contains(s, "://") && !hostRegexp.MatchString(s) {
+		link := &Link{Type: typ, ShareID: s}
+		if i := strings.Index(s, "@"); i >= 0 {
+			link.Passcode, link.ShareID = s[:i], s[i+1:]
+		}
+		if link.ShareID == "" || strings.ContainsAny(link.ShareID, "/?#") {
+			return nil, fmt.Errorf("invalid share id: %s", s)
+		}
+		return link, nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := urlpkg.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if len(segments) < 2 {
+		return nil, fmt.Errorf("unsupported link: %s", s)
+	}
+	link := &Link{ShareID: segments[1]}
+	switch segments[0] {
+	case "dir", "d":
+		link.Type = TypeFolder
+		if len(segments) > 2 && numericRegexp.MatchString(segments[2]) {
+			link.FolderID = segments[2]
+		}
+	case "file", "f":
+		link.Type = TypeFile
+	default:
+		return nil, fmt.Errorf("unsupported link: %s", s)
+	}
+	query := u.Query()
+	if folderID := query.Get("folder_id"); folderID != "" && link.Type == TypeFolder {
+		link.FolderID = folderID
+	}
+	for _, key := range passcodeParams {
+		if passcode := query.Get(key); passcode != "" {
+			link.Passcode = passcode
+			return link, nil
+		}
+	}
+	// the passcode may be the whole query, e.g. "?1234".
+	if u.RawQuery != "" && !strings.ContainsAny(u.RawQuery, "=&") {
+		link.Passcode = u.RawQuery
+	}
+	return link, nil
+}
+
+// String returns the share reference in the form of "passcode@shareID", which is accepted by ParseLink.
+func (l *Link) String() string {
+	if l.Passcode == "" {
+		return l.ShareID
+	}
+	return l.Passcode + "@" + l.ShareID
+}
@@ -0,0 +1,56 @@
+package ctfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		s    string
+		want *Link
+	}{
+		{"14332434-27583520-ec5ff3", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3"}},
+		{"1234@14332434-27583520-ec5ff3", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3", Passcode: "1234"}},
+		{"https://545c.com/dir/14332434-27583520-ec5ff3", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3"}},
+		{"https://545c.com/dir/14332434-27583520-ec5ff3?1234", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3", Passcode: "1234"}},
+		{"https://545c.com/dir/14332434-27583520-ec5ff3/33283567/", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3", FolderID: "33283567"}},
+		{"https://545c.com/dir/14332434-27583520-ec5ff3?folder_id=33283567&pwd=1234", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3", FolderID: "33283567", Passcode: "1234"}},
+		{"https://url89.ctfile.com/d/14332434-27583520-ec5ff3?p=1234", &Link{Type: TypeFolder, ShareID: "14332434-27583520-ec5ff3", Passcode: "1234"}},
+		{"http://u062.com/file/14332434-424853530", &Link{Type: TypeFile, ShareID: "14332434-424853530"}},
+		{"url89.ctfile.com/f/14332434-424853530-8a9c4e?pwd=1234", &Link{Type: TypeFile, ShareID: "14332434-424853530-8a9c4e", Passcode: "1234"}},
+		{" https://545c.com/file/14332434-424853530?passcode=abcd ", &Link{Type: TypeFile, ShareID: "14332434-424853530", Passcode: "abcd"}},
+		{"", nil},
+		{"1234@", nil},
+		{"https://545c.com/", nil},
+		{"https://545c.com/user/14332434", nil},
+	}
+	for _, test := range tests {
+		got, err := ParseLink(test.s)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("ParseLink(%q) = %+v, want error", test.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLink(%q) error: %v", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseLink(%q) = %+v, want %+v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestLink_String(t *testing.T) {
+	for _, s := range []string{"14332434-27583520-ec5ff3", "1234@14332434-27583520-ec5ff3"} {
+		link, err := ParseLink(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.String() != s {
+			t.Errorf("ParseLink(%q).String() = %q", s, link.String())
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const defaultPageSize = 100
+
+// maxListingTotal is the max count of files in a listing, a larger iTotalRecords is rejected.
+const maxListingTotal = 1 << 20
+
+// Page is a page of the folder listing.
+type Page struct {
+	// Start is the offset of the first file of this page in the whole listing.
+	Start int
+	// Total is the count of files in the whole listing.
+	Total int
+	Files []*File
+
+	// etag is the validator of the whole listing.
+	etag string
+}
+
+// ParseFiles returns the complete listing of the share, all pages of the listing are fetched.
+// The listing is served from the cache of WithCache if possible.
+func (c *Client) ParseFiles(share *Share) ([]*File, error) {
+	return c.ParseFilesContext(context.Background(), share)
+}
+
+// ParseFilesContext is like ParseFiles but with a context.
+func (c *Client) ParseFilesContext(ctx context.Context, share *Share) ([]*File, error) {
+	key, cacheable := listingKey(share), c.cache != nil
+	var etag string
+	var cached *CacheEntry
+	if cacheable {
+		entry, fresh := c.cacheGet(key)
+		if entry != nil && entry.Files != nil {
+			if fresh {
+				return entry.Files, nil
+			}
+			cached, etag = entry, entry.ETag
+		}
+	}
+	var (
+		files []*File
+		pages []*Page
+		total int
+	)
+	err := c.streamFiles(ctx, share, etag, func(page *Page) error {
+		if page.Start == 0 {
+			etag, total = page.etag, page.Total
+		}
+		pages = append(pages, page)
+		return nil
+	})
+	if err == errNotModified {
+		files = cached.Files
+		err = nil
+	} else if err == nil {
+		files, err = joinPages(pages, total)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		c.cacheSet(key, &CacheEntry{Share: share, Files: files, ETag: etag, Updated: time.Now()})
+	}
+	return files, nil
+}
+
+// joinPages joins the pages into the listing of total files, the pages must cover the listing without gaps.
+func joinPages(pages []*Page, total int) ([]*File, error) {
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Start < pages[j].Start })
+	files := make([]*File, 0)
+	for _, page := range pages {
+		if page.Start != len(files) {
+			return nil, fmt.Errorf("page at %d does not follow %d files, listing is changed during fetching", page.Start, len(files))
+		}
+		files = append(files, page.Files...)
+	}
+	if len(files) != total {
+		return nil, fmt.Errorf("got %d files of %d, listing is changed during fetching", len(files), total)
+	}
+	return files, nil
+}
+
+// StreamFiles calls fn with each page of the listing as it arrives,
+// pages may arrive out of order if the page concurrency is greater than 1, but fn is never called concurrently.
+// The error returned by fn stops the streaming and is returned by StreamFiles.
+func (c *Client) StreamFiles(share *Share, fn func(page *Page) error) error {
+	return c.StreamFilesContext(context.Background(), share, fn)
+}
+
+// StreamFilesContext is like StreamFiles but with a context.
+func (c *Client) StreamFilesContext(ctx context.Context, share *Share, fn func(page *Page) error) error {
+	return c.streamFiles(ctx, share, "", fn)
+}
+
+// streamFiles is like StreamFilesContext, but the first page is requested with If-None-Match if etag is not empty,
+// and errNotModified is returned if the listing is not modified.
+func (c *Client) streamFiles(ctx context.Context, share *Share, etag string, fn func(page *Page) error) error {
+	first, err := c.fetchPage(ctx, share, 0, c.pageSize, etag)
+	if err != nil {
+		return err
+	}
+	if err := fn(first); err != nil {
+		return err
+	}
+	// the server may return less files than requested, use it as the page size of the rest pages.
+	step := len(first.Files)
+	if step >= first.Total {
+		return nil
+	}
+	if step == 0 {
+		return fmt.Errorf("got an empty page of listing with %d files", first.Total)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, c.pageConcurrency)
+	)
+	setErr := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	for start := step; start < first.Total; start += step {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			page, err := c.fetchPage(ctx, share, start, step, "")
+			<-sem
+			mu.Lock()
+			defer mu.Unlock()
+			if firstErr != nil {
+				return
+			}
+			if err == nil {
+				err = fn(page)
+			}
+			if err != nil {
+				setErr(err)
+			}
+		}(start)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// errNotModified is returned by fetchPage if the listing matches the ETag.
+var errNotModified = errors.New("listing is not modified")
+
+func (c *Client) fetchPage(ctx context.Context, share *Share, start, length int, etag string) (*Page, error) {
+	url := fmt.Sprintf("%s%s", c.endpoint, share.Url)
+	header := map[string]string{"Origin": c.origin}
+	if etag != "" {
+		header["If-None-Match"] = etag
+	}
+	resp, err := c.do(ctx, http.MethodGet, url, map[string]string{
+		"iDisplayStart":  strconv.Itoa(start),
+		"iDisplayLength": strconv.Itoa(length),
+	}, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if etag != "" && resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+	data, err := readResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	page, err := parsePage(data, start)
+	if err != nil {
+		return nil, err
+	}
+	page.etag = resp.Header.Get("ETag")
+	return page, nil
+}
+
+// parsePage parses a page of the listing from the json response.
+func parsePage(data gjson.Result, start int) (*Page, error) {
+	rows := data.Get("aaData").Array()
+	files := make([]*File, 0, len(rows))
+	for i, row := range rows {
+		file, err := parseRow(i, row)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	page := &Page{Start: start, Total: len(files), Files: files}
+	// the listing without iTotalRecords is not paginated.
+	if total := data.Get("iTotalRecords"); total.Exists() {
+		n := total.Int()
+		if n < 0 || n > maxListingTotal {
+			return nil, fmt.Errorf("invalid total of listing: %d", n)
+		}
+		page.Total = int(n)
+	}
+	return page, nil
+}
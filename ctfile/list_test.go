@@ -0,0 +1,116 @@
+package ctfile
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+)
+
+func newPagedServer(n int) (*ctfiletest.Server, *Share) {
+	srv := ctfiletest.NewServer()
+	root := &ctfiletest.Folder{Name: "root"}
+	for i := 0; i < n; i++ {
+		root.Files = append(root.Files, &ctfiletest.File{Name: fmt.Sprintf("%02d.txt", i)})
+	}
+	srv.AddShare(&ctfiletest.Share{ID: "paged", Root: root})
+	share, err := NewClient(WithAPIEndpoint(srv.URL)).GetShareInfo("paged", "")
+	if err != nil {
+		panic(err)
+	}
+	return srv, share
+}
+
+func TestClient_ParseFiles_Pagination(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		srv, share := newPagedServer(25)
+		defer srv.Close()
+		// the server returns less files than requested.
+		srv.SetPageSize(7)
+		c := NewClient(WithAPIEndpoint(srv.URL), WithPageSize(10), WithPageConcurrency(concurrency))
+		files, err := c.ParseFiles(share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 25 {
+			t.Fatalf("ParseFiles() got %d files, want 25", len(files))
+		}
+		for i, file := range files {
+			if want := fmt.Sprintf("%02d.txt", i); file.Name != want {
+				t.Errorf("files[%d] = %s, want %s", i, file.Name, want)
+			}
+		}
+	}
+}
+
+func TestClient_StreamFiles(t *testing.T) {
+	srv, share := newPagedServer(25)
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithPageSize(10), WithPageConcurrency(2))
+
+	var (
+		mu    sync.Mutex
+		pages = make(map[int]int)
+	)
+	err := c.StreamFiles(share, func(page *Page) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if page.Total != 25 {
+			t.Errorf("page.Total = %d, want 25", page.Total)
+		}
+		pages[page.Start] = len(page.Files)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int{0: 10, 10: 10, 20: 5}; fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("StreamFiles() got pages %v, want %v", pages, want)
+	}
+
+	errStop := errors.New("stop")
+	var count int
+	err = c.StreamFiles(share, func(page *Page) error {
+		count++
+		return errStop
+	})
+	if err != errStop || count != 1 {
+		t.Errorf("StreamFiles() = %v after %d pages, want %v after 1 page", err, count, errStop)
+	}
+}
+
+func TestClient_ParseFiles_BadTotal(t *testing.T) {
+	rows := `["<input type=\"checkbox\" name=\"file_ids[]\" value=\"1-1\">","<a href=\"/file/1-1\">a.txt</a>","3 B","2019-12-01"]`
+	tests := []struct {
+		total int64
+		rows  int
+	}{
+		{-1, 1},
+		{maxListingTotal + 1, 1},
+		{5, 3},
+		{1, 3},
+	}
+	for _, tt := range tests {
+		tt := tt
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start, _ := strconv.Atoi(r.URL.Query().Get("iDisplayStart"))
+			data := make([]string, 0, tt.rows)
+			for i := start; i < tt.rows; i++ {
+				data = append(data, rows)
+			}
+			fmt.Fprintf(w, `{"iTotalRecords":%d,"aaData":[%s]}`, tt.total, strings.Join(data, ","))
+		}))
+		c := NewClient(WithAPIEndpoint(srv.URL))
+		files, err := c.ParseFiles(&Share{Url: "/iajax_guest.php?d=bad&folder_id=1"})
+		srv.Close()
+		if err == nil {
+			t.Errorf("ParseFiles() with total %d and %d rows = %d files, want error", tt.total, tt.rows, len(files))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package ctfile
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the web page of ctfile shows time in UTC+8.
+var location = time.FixedZone("CST", 8*60*60)
+
+var (
+	sizeRegexp     = regexp.MustCompile(`^([0-9]+)(?:\.([0-9]+))?\s*([A-Za-z字节]*)$`)
+	relativeRegexp = regexp.MustCompile(`^([0-9]+)\s*(秒|分钟|小时|天)前$`)
+)
+
+var sizeUnits = map[string]int64{
+	"":      1,
+	"b":     1,
+	"byte":  1,
+	"bytes": 1,
+	"字节":    1,
+	"k":     1 << 10,
+	"kb":    1 << 10,
+	"kib":   1 << 10,
+	"m":     1 << 20,
+	"mb":    1 << 20,
+	"mib":   1 << 20,
+	"g":     1 << 30,
+	"gb":    1 << 30,
+	"gib":   1 << 30,
+	"t":     1 << 40,
+	"tb":    1 << 40,
+	"tib":   1 << 40,
+}
+
+// parseSize parses the size shown on the web page like "1.2 GB",
+// the real size is in the range of size ± tolerance because the shown size is rounded.
+func parseSize(s string) (size, tolerance int64, ok bool) {
+	// large sizes are shown with thousands separators like "1,024 KB".
+	match := sizeRegexp.FindStringSubmatch(strings.ReplaceAll(strings.TrimSpace(s), ",", ""))
+	if match == nil {
+		return 0, 0, false
+	}
+	unit, ok := sizeUnits[strings.ToLower(match[3])]
+	if !ok {
+		return 0, 0, false
+	}
+	f, err := strconv.ParseFloat(match[1]+"."+match[2]+"0", 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size = int64(math.Round(f * float64(unit)))
+	if unit > 1 {
+		tolerance = int64(math.Ceil(0.5 * math.Pow10(-len(match[2])) * float64(unit)))
+	}
+	return size, tolerance, true
+}
+
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"2006年01月02日",
+}
+
+var shortDateLayouts = []string{
+	"01-02 15:04",
+	"01-02",
+}
+
+// lastDate returns the latest time not after now with the month, day and clock of t,
+// the year of which is skipped if the day is not in it, e.g. 02-29 in a non-leap year.
+func lastDate(t, now time.Time) time.Time {
+	for year := now.Year(); ; year-- {
+		d := time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+		if d.Month() == t.Month() && !d.After(now) {
+			return d
+		}
+	}
+}
+
+// parseDate parses the date shown on the web page, which may be an absolute date like "2019-12-01",
+// a date of this year like "12-01" or a relative time like "昨天 12:00" and "3小时前".
+func parseDate(s string, now time.Time) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	now = now.In(location)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t, true
+		}
+	}
+	for _, layout := range shortDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return lastDate(t, now), true
+		}
+	}
+	if s == "刚刚" {
+		return now, true
+	}
+	if match := relativeRegexp.FindStringSubmatch(s); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "秒":
+			return now.Add(-time.Duration(n) * time.Second), true
+		case "分钟":
+			return now.Add(-time.Duration(n) * time.Minute), true
+		case "小时":
+			return now.Add(-time.Duration(n) * time.Hour), true
+		case "天":
+			return now.AddDate(0, 0, -n), true
+		}
+	}
+	for prefix, days := range map[string]int{"今天": 0, "昨天": -1, "前天": -2} {
+		if !strings.HasPrefix(s, prefix) {
+			continue
+		}
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location).AddDate(0, 0, days)
+		clock := strings.TrimSpace(strings.TrimPrefix(s, prefix))
+		if clock == "" {
+			return day, true
+		}
+		for _, layout := range []string{"15:04:05", "15:04"} {
+			if t, err := time.Parse(layout, clock); err == nil {
+				return day.Add(time.Duration(t.Hour())*time.Hour +
+					time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseMeta fills the typed metadata of the file from the original strings.
+func (f *File) parseMeta() {
+	f.SizeBytes, f.SizeTolerance, _ = parseSize(f.Size)
+	f.ModTime, _ = parseDate(f.Date, time.Now())
+}
@@ -0,0 +1,83 @@
+package ctfile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s               string
+		size, tolerance int64
+		ok              bool
+	}{
+		{"512 B", 512, 0, true},
+		{"512", 512, 0, true},
+		{"1 KB", 1024, 512, true},
+		{"1.5 KB", 1536, 52, true},
+		{"1.23 MB", 1289748, 5243, true},
+		{"1.2GB", 1288490189, 53687092, true},
+		{"2 GiB", 2 << 30, 1 << 29, true},
+		{"3.0 tb", 3 << 40, 54975581389, true},
+		{"12 字节", 12, 0, true},
+		{"1,024 KB", 1 << 20, 512, true},
+		{"12,345,678", 12345678, 0, true},
+		{"- -", 0, 0, false},
+		{"", 0, 0, false},
+		{"1.2 PB", 0, 0, false},
+	}
+	for _, test := range tests {
+		size, tolerance, ok := parseSize(test.s)
+		if size != test.size || tolerance != test.tolerance || ok != test.ok {
+			t.Errorf("parseSize(%q) = %d, %d, %v, want %d, %d, %v",
+				test.s, size, tolerance, ok, test.size, test.tolerance, test.ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2019, 12, 10, 15, 30, 0, 0, location)
+	tests := []struct {
+		s    string
+		want time.Time
+		ok   bool
+	}{
+		{"2019-12-01", time.Date(2019, 12, 1, 0, 0, 0, 0, location), true},
+		{"2019-12-01 08:09", time.Date(2019, 12, 1, 8, 9, 0, 0, location), true},
+		{"2019-12-01 08:09:10", time.Date(2019, 12, 1, 8, 9, 10, 0, location), true},
+		{"2019/12/01", time.Date(2019, 12, 1, 0, 0, 0, 0, location), true},
+		{"2019年12月01日", time.Date(2019, 12, 1, 0, 0, 0, 0, location), true},
+		{"11-30", time.Date(2019, 11, 30, 0, 0, 0, 0, location), true},
+		{"12-31 10:00", time.Date(2018, 12, 31, 10, 0, 0, 0, location), true},
+		{"今天 10:00", time.Date(2019, 12, 10, 10, 0, 0, 0, location), true},
+		{"昨天 23:59", time.Date(2019, 12, 9, 23, 59, 0, 0, location), true},
+		{"前天", time.Date(2019, 12, 8, 0, 0, 0, 0, location), true},
+		{"3小时前", now.Add(-3 * time.Hour), true},
+		{"5 分钟前", now.Add(-5 * time.Minute), true},
+		{"2天前", now.AddDate(0, 0, -2), true},
+		{"刚刚", now, true},
+		{"- -", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseDate(test.s, now)
+		if !got.Equal(test.want) || ok != test.ok {
+			t.Errorf("parseDate(%q) = %s, %v, want %s, %v", test.s, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseDate_LeapDay(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 3, 1, 0, 0, 0, 0, location), time.Date(2024, 2, 29, 0, 0, 0, 0, location)},
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, location), time.Date(2024, 2, 29, 0, 0, 0, 0, location)},
+		{time.Date(2024, 2, 28, 0, 0, 0, 0, location), time.Date(2020, 2, 29, 0, 0, 0, 0, location)},
+	}
+	for _, test := range tests {
+		if got, ok := parseDate("02-29", test.now); !ok || !got.Equal(test.want) {
+			t.Errorf("parseDate(02-29) at %s = %s, %v, want %s", test.now, got, ok, test.want)
+		}
+	}
+}
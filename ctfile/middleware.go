@@ -0,0 +1,199 @@
+package ctfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware wraps the transport of Client to observe or modify every request and response,
+// it must follow the contract of http.RoundTripper, e.g. the request should be cloned before modified.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware appends middlewares to the transport of the http client, the first one is the outermost.
+// Middlewares are applied after all other options, so they wrap the transport set by WithTransport or WithProxy.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// applyMiddlewares wraps the transport of the http client with the middlewares.
+func (c *Client) applyMiddlewares() {
+	if len(c.middlewares) == 0 {
+		return
+	}
+	rt := c.hc.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		rt = c.middlewares[i](rt)
+	}
+	c.hc.Transport = rt
+}
+
+// LoggingMiddleware logs the method, url, status and duration of every request,
+// the standard logger is used if logger is nil. The passcodes in the query of the url are not logged.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			u := redactURL(req.URL)
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				logger.Printf("%s %s, error: %v (%s)", req.Method, u, redactError(err, req.URL, u), time.Since(start))
+				return nil, err
+			}
+			logger.Printf("%s %s, status: %d (%s)", req.Method, u, resp.StatusCode, time.Since(start))
+			return resp, nil
+		})
+	}
+}
+
+// redactURL returns the url without the passcode params in the query.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	redacted := false
+	for _, key := range passcodeParams {
+		if _, ok := q[key]; ok {
+			q.Del(key)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+	r := *u
+	r.RawQuery = q.Encode()
+	return r.String()
+}
+
+// redactError replaces the url of the request in the error, e.g. a *url.Error, with the redacted one.
+func redactError(err error, u *url.URL, redacted string) string {
+	return strings.ReplaceAll(err.Error(), u.String(), redacted)
+}
+
+// HeaderMiddleware sets the headers on every request, existing values of the same keys are replaced.
+func HeaderMiddleware(header http.Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for k, v := range header {
+				req.Header[http.CanonicalHeaderKey(k)] = v
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// CountingMiddleware increases n atomically for every request sent, including the failed ones.
+func CountingMiddleware(n *int64) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt64(n, 1)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// RecordMiddleware saves every response to the directory as a golden file which can be served by ReplayMiddleware,
+// a file is named by the request, so the response of the same request overwrites the previous one.
+// The files are the raw http responses, they may contain the cookies of the session.
+func RecordMiddleware(dir string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			name, err := recordName(req)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			b, err := httputil.DumpResponse(resp, true)
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			return resp, nil
+		})
+	}
+}
+
+// ReplayMiddleware serves the responses saved by RecordMiddleware from the directory without sending any request,
+// an error is returned for the request which has not been recorded.
+func ReplayMiddleware(dir string) Middleware {
+	return func(http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			name, err := recordName(req)
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+		})
+	}
+}
+
+// recordName returns the file name of the request like "getdir.php-0123456789abcdef.http",
+// the hash covers the method, the path, the sorted query and the body.
+func recordName(req *http.Request) (string, error) {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.Path, req.URL.Query().Encode())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return "", fmt.Errorf("can not read the body of %s %s", req.Method, req.URL)
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", err
+		}
+	}
+	base := strings.Trim(path.Base(req.URL.Path), "/.")
+	if base == "" {
+		base = "root"
+	}
+	return fmt.Sprintf("%s-%x.http", base, h.Sum(nil)[:8]), nil
+}
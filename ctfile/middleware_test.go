@@ -0,0 +1,146 @@
+package ctfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithMiddleware_Order(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	c := NewClient(
+		WithMiddleware(trace("first")),
+		WithAPIEndpoint(srv.URL),
+		WithMiddleware(trace("second")),
+		// middlewares wrap the transport even if it's set later.
+		WithTransport(http.DefaultTransport),
+	)
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHeaderMiddleware(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	c := NewClient(
+		WithUserAgent("ctfile-test"),
+		WithMiddleware(HeaderMiddleware(http.Header{"user-agent": {"injected"}, "X-Debug": {"1"}})),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			headers <- req.Header
+			return nil, http.ErrHandlerTimeout
+		})),
+	)
+	c.Account()
+	header := <-headers
+	if ua, debug := header.Get("User-Agent"), header.Get("X-Debug"); ua != "injected" || debug != "1" {
+		t.Errorf("unexpected request headers, User-Agent: %q, X-Debug: %q", ua, debug)
+	}
+}
+
+func TestCountingAndLoggingMiddleware(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	var (
+		n   int64
+		buf bytes.Buffer
+	)
+	c := NewClient(
+		WithAPIEndpoint(srv.URL),
+		WithOrigin(srv.URL),
+		WithMiddleware(CountingMiddleware(&n), LoggingMiddleware(log.New(&buf, "", 0))),
+	)
+	if _, err := c.GetShareInfo("1-2-abc", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || n != int64(srv.Requests()) {
+		t.Errorf("count = %d, server requests = %d, want 1", n, srv.Requests())
+	}
+	if line := buf.String(); !strings.HasPrefix(line, "GET "+srv.URL+"/getdir.php?") || !strings.Contains(line, "status: 200") {
+		t.Errorf("unexpected log: %q", line)
+	}
+}
+
+func TestLoggingMiddleware_Passcode(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	var buf bytes.Buffer
+	c := NewClient(
+		WithAPIEndpoint(srv.URL),
+		WithOrigin(srv.URL),
+		WithMiddleware(LoggingMiddleware(log.New(&buf, "", 0))),
+	)
+	if _, err := c.GetShareInfo("1234@1-3-def", ""); err != nil {
+		t.Fatal(err)
+	}
+	if line := buf.String(); !strings.Contains(line, "/getdir.php?") || strings.Contains(line, "1234") {
+		t.Errorf("unexpected log: %q", line)
+	}
+}
+
+func TestRecordAndReplayMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctfile-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newFakeServer()
+	run := func(c *Client) []string {
+		if err := c.Login("alice", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		share, err := c.GetShareInfo("1-2-abc", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := c.ParseFiles(share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+		return names
+	}
+	recorded := run(NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithMiddleware(RecordMiddleware(dir))))
+	srv.Close()
+
+	golden, err := filepath.Glob(filepath.Join(dir, "*.http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(golden) != 3 {
+		t.Errorf("recorded files = %v, want 3 files", golden)
+	}
+
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithMiddleware(ReplayMiddleware(dir)))
+	if replayed := run(c); !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed files = %v, want %v", replayed, recorded)
+	}
+	if c.PubCookie() == "" {
+		t.Error("cookie of the recorded login is not replayed")
+	}
+	if err := c.Login("alice", "bad"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("Login() of an unrecorded request = %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/hr3lxphr6j/ctfile/utils"
+)
+
+// errRangeEnd is returned by fileReader.open if the offset is at or beyond the end of the file.
+var errRangeEnd = errors.New("range is not satisfiable")
+
+// Open opens the file for reading through the VIP download url, the download urls are fetched
+// immediately, so errors like ErrNotVIP are returned by Open, and the content is requested on the first Read.
+//
+// The returned reader requests the content with http Range from the offset of the reader, so Seek is cheap.
+// An expired download url is refreshed transparently, and the mirrors of the download urls
+// are tried in turn if one of them fails.
+func (c *Client) Open(file *File) (io.ReadSeekCloser, error) {
+	return c.OpenContext(context.Background(), file)
+}
+
+// OpenContext is like Open but with a context, which is used by all requests of the reader.
+// The content is not limited by WithTimeout nor observed by the middlewares, use the context to limit it.
+func (c *Client) OpenContext(ctx context.Context, file *File) (io.ReadSeekCloser, error) {
+	r := &fileReader{c: c, hc: c.downloadClient(), ctx: ctx, file: file, size: -1}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type fileReader struct {
+	c    *Client
+	hc   *http.Client
+	ctx  context.Context
+	file *File
+
+	// urls are the download urls sorted by the mirror name, mirror is the index of the one in use.
+	urls   []string
+	mirror int
+
+	body   io.ReadCloser
+	offset int64
+	// size is -1 until it's known from a response.
+	size   int64
+	closed bool
+}
+
+// refresh fetches the download urls again.
+func (r *fileReader) refresh() error {
+	urls, err := r.c.GetDownloadUrlContext(r.ctx, r.file)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return errors.New("no download url")
+	}
+	mirrors := make([]string, 0, len(urls))
+	for mirror := range urls {
+		mirrors = append(mirrors, mirror)
+	}
+	sort.Strings(mirrors)
+	r.urls = r.urls[:0]
+	for _, mirror := range mirrors {
+		r.urls = append(r.urls, urls[mirror])
+	}
+	r.mirror %= len(r.urls)
+	return nil
+}
+
+// open requests the content from the offset, the next mirror is tried if the current one fails,
+// and the urls are refreshed once if they are expired or all mirrors fail.
+func (r *fileReader) open() error {
+	var (
+		refreshed bool
+		failed    int
+	)
+	for {
+		err := r.request(r.urls[r.mirror])
+		if err == nil || err == errRangeEnd || r.ctx.Err() != nil {
+			return err
+		}
+		var statusErr *StatusError
+		expired := errors.As(err, &statusErr) &&
+			(statusErr.StatusCode == http.StatusForbidden || statusErr.StatusCode == http.StatusGone)
+		if !expired {
+			failed++
+			r.mirror = (r.mirror + 1) % len(r.urls)
+		}
+		if expired || failed >= len(r.urls) {
+			if refreshed {
+				return err
+			}
+			if err := r.refresh(); err != nil {
+				return err
+			}
+			refreshed, failed = true, 0
+		}
+	}
+}
+
+func (r *fileReader) request(url string) error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if r.c.userAgent != "" {
+		req.Header.Set("User-Agent", r.c.userAgent)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if size, ok := utils.ParseContentRange(resp.Header.Get("Content-Range")); ok {
+			r.size = size
+		}
+	case http.StatusOK:
+		// the server ignores the range, skip to the offset.
+		if resp.ContentLength >= 0 {
+			r.size = resp.ContentLength
+		}
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		if size, ok := utils.ParseContentRange(resp.Header.Get("Content-Range")); ok {
+			r.size = size
+		}
+		return errRangeEnd
+	default:
+		resp.Body.Close()
+		return checkStatus(resp)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	if r.size >= 0 && r.offset >= r.size {
+		return 0, io.EOF
+	}
+	for attempt := 0; ; attempt++ {
+		if r.body == nil {
+			if err := r.open(); err == errRangeEnd {
+				return 0, io.EOF
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		switch {
+		case err == nil:
+			return n, nil
+		case err == io.EOF && (r.size < 0 || r.offset >= r.size):
+			return n, io.EOF
+		}
+		// the connection is broken before the end, resume from the offset with the next mirror.
+		r.body.Close()
+		r.body = nil
+		r.mirror = (r.mirror + 1) % len(r.urls)
+		if n > 0 {
+			return n, nil
+		}
+		if attempt >= len(r.urls) || r.ctx.Err() != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+}
+
+// Seek sets the offset of the next Read, the content is requested again from the new offset.
+// Seeking relative to the end requests the content once to learn the size if it's unknown.
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		if r.size < 0 {
+			// the open body is replaced to learn the size.
+			if r.body != nil {
+				r.body.Close()
+				r.body = nil
+			}
+			if err := r.open(); err != nil && err != errRangeEnd {
+				return 0, err
+			}
+		}
+		if r.size < 0 {
+			return 0, errors.New("size of the file is unknown")
+		}
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *fileReader) Close() error {
+	if r.closed {
+		return fs.ErrClosed
+	}
+	r.closed = true
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package ctfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+)
+
+// newOpenTest logs in a VIP and returns a file of 64 KiB and its content.
+func newOpenTest(t *testing.T) (*ctfiletest.Server, *Client, *File, []byte) {
+	t.Helper()
+	srv, c := newTestServer()
+	content := make([]byte, 64<<10)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	srv.AddFileShare(&ctfiletest.FileShare{
+		ID: "1-8-big", UserID: 1, Username: "alice",
+		File: &ctfiletest.File{Name: "big.bin", Content: content},
+	})
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := c.GetFileShareInfo("1-8-big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, c, file, content
+}
+
+func TestClient_Open(t *testing.T) {
+	srv, c, file, content := newOpenTest(t)
+	defer srv.Close()
+	r, err := c.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("ReadAll() read %d bytes, want the content of %d bytes", len(b), len(content))
+	}
+
+	tests := []struct {
+		offset int64
+		whence int
+		pos    int64
+	}{
+		{100, io.SeekStart, 100},
+		{-10, io.SeekEnd, int64(len(content)) - 10},
+		{-1000, io.SeekCurrent, int64(len(content)) - 1010},
+		{0, io.SeekStart, 0},
+	}
+	for _, test := range tests {
+		pos, err := r.Seek(test.offset, test.whence)
+		if err != nil || pos != test.pos {
+			t.Errorf("Seek(%d, %d) = %d, %v, want %d", test.offset, test.whence, pos, err, test.pos)
+			continue
+		}
+		buf := make([]byte, 10)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, content[pos:pos+10]) {
+			t.Errorf("Read() after Seek(%d, %d) = %v, want %v", test.offset, test.whence, buf, content[pos:pos+10])
+		}
+		// rewind to the position of Seek, so the next SeekCurrent is relative to it.
+		r.Seek(pos, io.SeekStart)
+	}
+
+	if _, err := r.Seek(int64(len(content))+10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("Read() beyond the end = %d, %v, want 0, EOF", n, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek() to a negative position succeeded")
+	}
+}
+
+func TestClient_Open_Error(t *testing.T) {
+	srv, c, file, _ := newOpenTest(t)
+	defer srv.Close()
+	if err := c.Login("bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Open(file); !errors.Is(err, ErrNotVIP) {
+		t.Errorf("Open() by a normal user = %v, want %v", err, ErrNotVIP)
+	}
+}
+
+func TestClient_Open_ExpiredLink(t *testing.T) {
+	srv, c, file, content := newOpenTest(t)
+	defer srv.Close()
+	srv.SetLinkTTL(50 * time.Millisecond)
+	r, err := c.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	requests := srv.Requests()
+	r.Seek(1000, io.SeekStart)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("Read() after the link expired = %v", err)
+	}
+	if !bytes.Equal(buf, content[1000:1010]) {
+		t.Errorf("Read() = %v, want %v", buf, content[1000:1010])
+	}
+	if n := srv.Requests() - requests; n != 1 {
+		t.Errorf("download urls are fetched %d times, want 1", n)
+	}
+}
+
+func TestClient_Open_Failover(t *testing.T) {
+	srv, c, file, content := newOpenTest(t)
+	defer srv.Close()
+	srv.SetMirrorDown("dx", true)
+	r, err := c.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("ReadAll() with a mirror down = %v", err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("ReadAll() read %d bytes, want the content of %d bytes", len(b), len(content))
+	}
+
+	for _, mirror := range []string{"lt", "yd"} {
+		srv.SetMirrorDown(mirror, true)
+	}
+	if r, err = c.Open(file); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var statusErr *StatusError
+	if _, err := r.Read(make([]byte, 10)); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Read() with all mirrors down = %v, want StatusCode 503", err)
+	}
+}
+
+func TestClient_Open_Timeout(t *testing.T) {
+	srv, _, file, content := newOpenTest(t)
+	defer srv.Close()
+	var downloads, n int64
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.URL.Path, "/download/") {
+			atomic.AddInt64(&downloads, 1)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	c := NewClient(
+		WithAPIEndpoint(srv.URL),
+		WithOrigin(srv.URL),
+		WithTransport(transport),
+		WithTimeout(50*time.Millisecond),
+		WithMiddleware(CountingMiddleware(&n)),
+	)
+	base := srv.Requests()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	head := make([]byte, 1)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	// the content is read longer than the timeout of the api requests.
+	time.Sleep(100 * time.Millisecond)
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(head, rest...), content) {
+		t.Errorf("read %d bytes, want the content of %d bytes", len(rest)+1, len(content))
+	}
+	if downloads != 1 {
+		t.Errorf("content is requested %d times, want 1", downloads)
+	}
+	if api := srv.Requests() - base; n != int64(api) {
+		t.Errorf("middleware counted %d requests, want the %d api requests", n, api)
+	}
+}
+
+// trackedBody counts the response bodies which are not closed.
+type trackedBody struct {
+	io.ReadCloser
+	open *int64
+	once sync.Once
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(func() { atomic.AddInt64(b.open, -1) })
+	return b.ReadCloser.Close()
+}
+
+func TestClient_Open_SeekEndUnknownSize(t *testing.T) {
+	srv, _, file, content := newOpenTest(t)
+	defer srv.Close()
+	var open int64
+	// the size is unknown without the Content-Range and Content-Length of the content.
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil || !strings.HasPrefix(req.URL.Path, "/download/") {
+			return resp, err
+		}
+		resp.Header.Del("Content-Range")
+		resp.ContentLength = -1
+		atomic.AddInt64(&open, 1)
+		resp.Body = &trackedBody{ReadCloser: resp.Body, open: &open}
+		return resp, nil
+	})
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithTransport(transport))
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(head, content[:10]) {
+		t.Errorf("Read() = %v, want %v", head, content[:10])
+	}
+	if _, err := r.Seek(0, io.SeekEnd); err == nil {
+		t.Error("Seek() to the end of unknown size = nil, want an error")
+	}
+	if n := atomic.LoadInt64(&open); n != 1 {
+		t.Errorf("%d response bodies are open after Seek(), want 1", n)
+	}
+	r.Close()
+	if n := atomic.LoadInt64(&open); n != 0 {
+		t.Errorf("%d response bodies are open after Close(), want 0", n)
+	}
+}
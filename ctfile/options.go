@@ -0,0 +1,89 @@
+package ctfile
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"time"
+)
+
+type Option func(*Client)
+
+// WithAPIEndpoint sets the base url of web api, default is https://webapi.400gb.com.
+func WithAPIEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithOrigin sets the Origin header sent to web api, default is https://545c.com.
+func WithOrigin(origin string) Option {
+	return func(c *Client) {
+		c.origin = strings.TrimRight(origin, "/")
+	}
+}
+
+// WithHTTPClient sets the http client used by Client, the client is copied,
+// and the default cookie jar is used if it has none.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		client := *hc
+		if client.Jar == nil {
+			client.Jar = c.hc.Jar
+		}
+		c.hc = &client
+	}
+}
+
+// WithTransport sets the transport of the http client.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.hc.Transport = rt
+	}
+}
+
+// WithProxy sets the proxy of the http client.
+// Transport which is not an *http.Transport will be replaced by a copy of http.DefaultTransport.
+func WithProxy(proxy *urlpkg.URL) Option {
+	return func(c *Client) {
+		t, ok := c.hc.Transport.(*http.Transport)
+		if !ok || t == nil {
+			t = http.DefaultTransport.(*http.Transport)
+		}
+		t = t.Clone()
+		t.Proxy = http.ProxyURL(proxy)
+		c.hc.Transport = t
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithTimeout sets the time limit of every request, zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.hc.Timeout = timeout
+	}
+}
+
+// WithPageSize sets the count of files requested in a page of the folder listing, default is 100.
+func WithPageSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.pageSize = size
+		}
+	}
+}
+
+// WithPageConcurrency sets the count of pages of the folder listing fetched concurrently, default is 1.
+func WithPageConcurrency(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.pageConcurrency = n
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+)
+
+// maxPasscodeAttempts is the max count of passcodes asked from the PasscodeProvider for a request.
+const maxPasscodeAttempts = 3
+
+// PasscodeProvider is called when the passcode of a share is required or wrong, err is
+// ErrPasscodeRequired or ErrWrongPasscode. Returning an empty passcode gives up with err.
+type PasscodeProvider func(ctx context.Context, shareID string, err error) (string, error)
+
+// WithPasscodeProvider sets the PasscodeProvider, the accepted passcodes are remembered
+// by the Client, so it's asked at most once for each share if the passcode is right.
+func WithPasscodeProvider(provider PasscodeProvider) Option {
+	return func(c *Client) {
+		c.passcodeProvider = provider
+	}
+}
+
+func isPasscodeError(err error) bool {
+	return errors.Is(err, ErrPasscodeRequired) || errors.Is(err, ErrWrongPasscode)
+}
+
+// withPasscode calls fn with the passcode of the link or the remembered one, and asks the PasscodeProvider
+// for a new passcode if the passcode is required or wrong.
+func (c *Client) withPasscode(ctx context.Context, link *Link, fn func(passcode string) error) error {
+	passcode := link.Passcode
+	if passcode == "" {
+		passcode = c.passcode(link.ShareID)
+	}
+	for attempt := 0; ; attempt++ {
+		err := fn(passcode)
+		if err == nil {
+			if passcode != "" {
+				c.passcodes.Store(link.ShareID, passcode)
+			}
+			return nil
+		}
+		if c.passcodeProvider == nil || attempt >= maxPasscodeAttempts || !isPasscodeError(err) {
+			return err
+		}
+		next, perr := c.passcodeProvider(ctx, link.ShareID, err)
+		if perr != nil {
+			return perr
+		}
+		if next == "" {
+			return err
+		}
+		passcode = next
+	}
+}
+
+// passcode returns the remembered passcode of the share, or an empty string.
+func (c *Client) passcode(shareID string) string {
+	if v, ok := c.passcodes.Load(shareID); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// restorePasscode remembers the passcode of the share served from the cache and sets the cookie of it,
+// which is required by the uncached requests of the share later.
+func (c *Client) restorePasscode(link *Link, entry *CacheEntry) {
+	passcode := link.Passcode
+	if passcode == "" {
+		passcode = entry.Passcode
+	}
+	if passcode == "" {
+		passcode = c.passcode(link.ShareID)
+	}
+	if passcode == "" {
+		return
+	}
+	c.passcodes.Store(link.ShareID, passcode)
+	c.setPasscodeCookie(entry.Share.FolderID, passcode)
+}
@@ -0,0 +1,66 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClient_GetShareInfo_PasscodeErrors(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	if _, err := c.GetShareInfo("1-3-def", ""); !errors.Is(err, ErrPasscodeRequired) {
+		t.Errorf("GetShareInfo() without passcode = %v, want %v", err, ErrPasscodeRequired)
+	}
+	if _, err := c.GetShareInfo("0000@1-3-def", ""); !errors.Is(err, ErrWrongPasscode) {
+		t.Errorf("GetShareInfo() with wrong passcode = %v, want %v", err, ErrWrongPasscode)
+	}
+}
+
+func TestWithPasscodeProvider(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	var calls []error
+	c := NewClient(WithAPIEndpoint(srv.URL), WithPasscodeProvider(func(ctx context.Context, shareID string, err error) (string, error) {
+		calls = append(calls, err)
+		switch shareID {
+		case "1-3-def":
+			if len(calls) == 1 {
+				return "0000", nil
+			}
+			return "1234", nil
+		case "1-9-ghi":
+			return "5678", nil
+		}
+		return "", nil
+	}))
+	var files []string
+	err := c.Walk("1-3-def", "", func(curPath string, share *Share, file *File) bool {
+		files = append(files, file.Name)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "d.txt" {
+		t.Errorf("Walk() visited %v", files)
+	}
+	if len(calls) != 2 || !errors.Is(calls[0], ErrPasscodeRequired) || !errors.Is(calls[1], ErrWrongPasscode) {
+		t.Errorf("provider is called with %v", calls)
+	}
+	// the passcode is remembered.
+	if _, err := c.GetShareInfo("1-3-def", ""); err != nil || len(calls) != 2 {
+		t.Errorf("GetShareInfo() = %v after %d calls of provider", err, len(calls))
+	}
+	if _, err := c.GetFileShareInfo("1-9-ghi"); err != nil {
+		t.Errorf("GetFileShareInfo() = %v", err)
+	}
+
+	errAbort := errors.New("abort")
+	c = NewClient(WithAPIEndpoint(srv.URL), WithPasscodeProvider(func(ctx context.Context, shareID string, err error) (string, error) {
+		return "", errAbort
+	}))
+	if _, err := c.GetShareInfo("1-3-def", ""); err != errAbort {
+		t.Errorf("GetShareInfo() = %v, want %v", err, errAbort)
+	}
+}
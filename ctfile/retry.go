@@ -0,0 +1,127 @@
+package ctfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/dimchansky/utfbom"
+	"github.com/tidwall/gjson"
+	ratelimit "golang.org/x/time/rate"
+
+	"github.com/hr3lxphr6j/ctfile/utils"
+)
+
+// RetryPolicy returns the backoff of a request, the failed request is retried after the duration returned
+// by NextBackOff until it returns backoff.Stop. It's called for every request, so the returned backoff
+// must not be shared.
+type RetryPolicy func() backoff.BackOff
+
+// DefaultRetryPolicy retries a request at most 3 times with exponential backoff.
+func DefaultRetryPolicy() backoff.BackOff {
+	return backoff.NewExponentialBackoffBuilder().MaxRetries(3).Build()
+}
+
+// WithRetryPolicy sets the retry policy of every request, retryable errors are classified by IsRetryable,
+// and the Retry-After of a rate limit response is honored. Default is no retry.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// RateLimiter limits the rate of requests sent by Client.
+type RateLimiter interface {
+	// Wait blocks until the next request is allowed, or returns ctx.Err() once the context is done.
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter sets the rate limiter of every request including retries, default is unlimited.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(c *Client) {
+		c.rateLimiter = limiter
+	}
+}
+
+type rateLimiter struct {
+	rl *ratelimit.Limiter
+}
+
+// NewRateLimiter returns a RateLimiter which allows rate requests per second.
+func NewRateLimiter(rate int) RateLimiter {
+	return &rateLimiter{rl: ratelimit.NewLimiter(ratelimit.Limit(rate), 1)}
+}
+
+// Wait takes a slot of the limiter, the slot is given back if the context is done before that.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	return utils.WaitN(ctx, l.rl, 1)
+}
+
+// IsRetryable reports whether a failed request is worth retrying, which is true for rate limit responses,
+// http status 5xx, timeouts, temporary network errors and broken connections.
+// Errors which are not going away soon, like a refused connection or an unknown host, are not retryable.
+func IsRetryable(err error) bool {
+	var (
+		statusErr *StatusError
+		netErr    net.Error
+	)
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, ErrRateLimited):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()):
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryableStatus returns the error of the response if its http status is worth retrying.
+func retryableStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return checkStatus(resp)
+	}
+	return nil
+}
+
+// retryableCode returns the error of the response if the code of web api in its body is worth retrying,
+// e.g. the rate limit responded with http status 200. The body is read and replaced by a copy of it without the BOM.
+func retryableCode(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	b, err := ioutil.ReadAll(utfbom.SkipOnly(resp.Body))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	result := gjson.ParseBytes(b)
+	if code := result.Get("code"); code.Exists() && code.Int() == codeRateLimited {
+		return &APIError{Code: codeRateLimited, Message: result.Get("message").String()}
+	}
+	return nil
+}
+
+// sleep waits for d, it returns ctx.Err() if the context is done before that.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
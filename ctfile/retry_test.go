@@ -0,0 +1,201 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+)
+
+// fastRetry retries at most n times without waiting long.
+func fastRetry(n uint64) RetryPolicy {
+	return func() backoff.BackOff {
+		return backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond), n)
+	}
+}
+
+func TestClient_Retry_RateLimit(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithRetryPolicy(fastRetry(3)))
+	srv.RateLimit(2, 0)
+	if _, err := c.GetShareInfo("1-2-abc", ""); err != nil {
+		t.Fatalf("GetShareInfo() = %v", err)
+	}
+	if n := srv.Requests(); n != 3 {
+		t.Errorf("Requests() = %d, want 3", n)
+	}
+
+	srv.RateLimit(5, 0)
+	var rlErr *RateLimitError
+	if _, err := c.GetShareInfo("1-2-abc", ""); !errors.As(err, &rlErr) {
+		t.Errorf("GetShareInfo() after max retry = %v, want a RateLimitError", err)
+	}
+	if n := srv.Requests(); n != 7 {
+		t.Errorf("Requests() = %d, want 7", n)
+	}
+}
+
+func TestClient_Retry_RateLimitInBody(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithRetryPolicy(fastRetry(3)))
+	srv.RateLimitInBody(2)
+	if _, err := c.GetShareInfo("1-2-abc", ""); err != nil {
+		t.Fatalf("GetShareInfo() = %v", err)
+	}
+	if n := srv.Requests(); n != 3 {
+		t.Errorf("Requests() = %d, want 3", n)
+	}
+
+	srv.RateLimitInBody(5)
+	if _, err := c.GetShareInfo("1-2-abc", ""); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("GetShareInfo() after max retry = %v, want %v", err, ErrRateLimited)
+	}
+	if n := srv.Requests(); n != 7 {
+		t.Errorf("Requests() = %d, want 7", n)
+	}
+}
+
+func TestClient_Retry_ServerError(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithRetryPolicy(fastRetry(3)))
+	srv.Fail(2, http.StatusBadGateway)
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if n := srv.Requests(); n != 3 {
+		t.Errorf("Requests() = %d, want 3", n)
+	}
+
+	// the error of web api is not retried.
+	if err := c.Login("alice", "bad"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Login() = %v, want %v", err, ErrWrongPassword)
+	}
+	if n := srv.Requests(); n != 4 {
+		t.Errorf("Requests() = %d, want 4", n)
+	}
+
+	// http status 4xx is not retried.
+	srv.Fail(1, http.StatusForbidden)
+	var statusErr *StatusError
+	if _, err := c.Account(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Account() = %v, want StatusCode 403", err)
+	}
+	if n := srv.Requests(); n != 5 {
+		t.Errorf("Requests() = %d, want 5", n)
+	}
+}
+
+func TestClient_Retry_NoPolicy(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	srv.Fail(1, http.StatusInternalServerError)
+	if _, err := c.Account(); err == nil {
+		t.Error("Account() = nil, want an error")
+	}
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("Requests() = %d, want 1", n)
+	}
+}
+
+func TestClient_Retry_Context(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithRetryPolicy(fastRetry(3)))
+	srv.RateLimit(1, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.AccountContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AccountContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("AccountContext() returned after %s, Retry-After should be interrupted by the context", d)
+	}
+}
+
+func TestClient_RateLimiter(t *testing.T) {
+	srv := newFakeServer()
+	defer srv.Close()
+	c := NewClient(WithAPIEndpoint(srv.URL), WithOrigin(srv.URL), WithRateLimiter(NewRateLimiter(20)))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		c.Account()
+	}
+	// the first request is not delayed, the others are 50ms apart.
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("5 requests took %s, want about 200ms", d)
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	l := NewRateLimiter(1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Wait() with a done context = nil")
+	}
+
+	// the canceled waits leave no goroutine behind.
+	base := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		l.Wait(ctx)
+		cancel()
+	}
+	if n := runtime.NumGoroutine(); n > base {
+		t.Errorf("%d goroutines after the canceled waits, want at most %d", n, base)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&RateLimitError{}, true},
+		{&APIError{Code: codeRateLimited}, true},
+		{&StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&StatusError{StatusCode: http.StatusNotFound}, false},
+		{fmt.Errorf("get: %w", timeoutError{}), true},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, false},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}, false},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}}, true},
+		{io.ErrUnexpectedEOF, true},
+		{context.Canceled, false},
+		{&APIError{Code: codeNotVIP}, false},
+		{ErrWrongPassword, false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ctfile
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"golang.org/x/net/html"
+)
+
+var subdirRegexp = regexp.MustCompile(`load_subdir\(\s*['"]?(\d+)`)
+
+// element is a html element found in a cell of the listing.
+type element struct {
+	attrs map[string]string
+	// text is the inner text with entities unescaped.
+	text string
+}
+
+// findElement returns the first element of the tag in the html fragment.
+func findElement(fragment, tag string) (*element, bool) {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var (
+		found *element
+		depth int
+		text  strings.Builder
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if found != nil {
+				found.text = strings.TrimSpace(text.String())
+			}
+			return found, found != nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != tag {
+				continue
+			}
+			if found != nil {
+				if tt == html.StartTagToken {
+					depth++
+				}
+				continue
+			}
+			found = &element{attrs: make(map[string]string)}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				found.attrs[string(key)] = string(val)
+			}
+			if tt == html.SelfClosingTagToken || isVoidElement(tag) {
+				return found, true
+			}
+			depth = 1
+		case html.EndTagToken:
+			if name, _ := z.TagName(); found != nil && string(name) == tag {
+				if depth--; depth == 0 {
+					found.text = strings.TrimSpace(text.String())
+					return found, true
+				}
+			}
+		case html.TextToken:
+			if found != nil {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "input", "img", "br", "hr", "meta", "link":
+		return true
+	}
+	return false
+}
+
+// innerText returns the text of the html fragment with tags removed and entities unescaped.
+func innerText(fragment string) string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var text strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case html.TextToken:
+			text.Write(z.Text())
+		}
+	}
+}
+
+// parseRow parses a row of the listing, which is [checkbox, link, size, date] in html.
+func parseRow(index int, row gjson.Result) (*File, error) {
+	cells := row.Array()
+	if len(cells) < 4 {
+		return nil, &ParseError{Row: index, Raw: row.Raw, Message: fmt.Sprintf("got %d cells, want 4", len(cells))}
+	}
+	file := &File{
+		Size: innerText(cells[2].String()),
+		Date: innerText(cells[3].String()),
+	}
+	checkbox, _ := findElement(cells[0].String(), "input")
+	if checkbox != nil && strings.HasPrefix(checkbox.attrs["name"], "folder") {
+		file.Type = TypeFolder
+	}
+	link, ok := findElement(cells[1].String(), "a")
+	if ok {
+		file.Name = link.text
+	} else {
+		file.Name = innerText(cells[1].String())
+	}
+	switch file.Type {
+	case TypeFile:
+		if link != nil {
+			file.ID = fileIDFromHref(link.attrs["href"])
+		}
+		if file.ID == "" && checkbox != nil {
+			file.ID = checkbox.attrs["value"]
+		}
+	case TypeFolder:
+		if checkbox != nil {
+			file.ID = checkbox.attrs["value"]
+		}
+		if file.ID == "" && link != nil {
+			if match := subdirRegexp.FindStringSubmatch(link.attrs["onclick"]); match != nil {
+				file.ID = match[1]
+			}
+		}
+	}
+	switch {
+	case file.Name == "":
+		return nil, &ParseError{Row: index, Raw: row.Raw, Message: "no name"}
+	case file.ID == "":
+		return nil, &ParseError{Row: index, Raw: row.Raw, Message: "no id"}
+	}
+	file.parseMeta()
+	return file, nil
+}
+
+// fileIDFromHref returns the file ID of links like "/file/1-2345" and "https://545c.com/f/1-2345?p=1234".
+func fileIDFromHref(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	dir, id := path.Split(strings.TrimRight(u.Path, "/"))
+	switch dir {
+	case "/file/", "/f/":
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package ctfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// loadPage parses the listing response in testdata/listing.
+func loadPage(t *testing.T, name string) (*Page, error) {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "listing", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsePage(gjson.ParseBytes(b), 0)
+}
+
+func TestParsePage(t *testing.T) {
+	type entry struct {
+		Type Type
+		ID   string
+		Name string
+		Size string
+		Date string
+	}
+	tests := []struct {
+		fixture string
+		want    []entry
+	}{
+		{"basic.json", []entry{
+			{TypeFolder, "1002", "sub", "- -", "2019-12-02"},
+			{TypeFile, "1-1001", "a.txt", "3 B", "2019-12-01"},
+			{TypeFile, "1-1003", "video.mp4", "1.20 GB", "2019-12-03 12:30"},
+		}},
+		{"entities.json", []entry{
+			{TypeFolder, "2001", "Tom & Jerry", "- -", "2020-01-01"},
+			{TypeFile, "1-2002", "<draft> 'v2'.txt", "12.5 KB", "2020-01-02"},
+			{TypeFile, "1-2003", "资料\u00a0合集.zip", "2.00 MB", "2020-01-03"},
+		}},
+		{"markup.json", []entry{
+			{TypeFolder, "3001", "Single Quoted", "- -", "2021-03-01"},
+			{TypeFile, "1-3002", "reordered.txt", "100 B", "2021-03-02"},
+			{TypeFolder, "3003", "no value", "- -", "2021-03-03"},
+			{TypeFile, "1-3004", "no href", "1 B", "2021-03-04"},
+		}},
+	}
+	for _, test := range tests {
+		page, err := loadPage(t, test.fixture)
+		if err != nil {
+			t.Errorf("%s: %v", test.fixture, err)
+			continue
+		}
+		if page.Total != len(test.want) || len(page.Files) != len(test.want) {
+			t.Errorf("%s: got %d files of %d, want %d", test.fixture, len(page.Files), page.Total, len(test.want))
+			continue
+		}
+		for i, file := range page.Files {
+			got := entry{file.Type, file.ID, file.Name, file.Size, file.Date}
+			if got != test.want[i] {
+				t.Errorf("%s: row %d = %+v, want %+v", test.fixture, i, got, test.want[i])
+			}
+		}
+	}
+}
+
+func TestParsePage_Metadata(t *testing.T) {
+	page, err := loadPage(t, "entities.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := page.Files[1]; file.SizeBytes != 12800 || file.ModTime.IsZero() {
+		t.Errorf("unexpected metadata: %d, %s", file.SizeBytes, file.ModTime)
+	}
+}
+
+func TestParsePage_Error(t *testing.T) {
+	tests := []struct {
+		fixture string
+		row     int
+	}{
+		{"short_row.json", 1},
+		{"no_id.json", 0},
+		{"no_name.json", 0},
+	}
+	for _, test := range tests {
+		_, err := loadPage(t, test.fixture)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: err = %v, want a ParseError", test.fixture, err)
+			continue
+		}
+		if parseErr.Row != test.row || parseErr.Raw == "" {
+			t.Errorf("%s: unexpected error: %+v", test.fixture, parseErr)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ctfile
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	urlpkg "net/url"
+	"sync"
+)
+
+// session is the cookie jar of the client and the login state, which are shared by the concurrent requests,
+// and reset by Logout.
+type session struct {
+	mu      sync.RWMutex
+	jar     http.CookieJar
+	isLogin bool
+}
+
+func (s *session) SetCookies(u *urlpkg.URL, cookies []*http.Cookie) {
+	s.mu.RLock()
+	jar := s.jar
+	s.mu.RUnlock()
+	jar.SetCookies(u, cookies)
+}
+
+func (s *session) Cookies(u *urlpkg.URL) []*http.Cookie {
+	s.mu.RLock()
+	jar := s.jar
+	s.mu.RUnlock()
+	return jar.Cookies(u)
+}
+
+func (s *session) loggedIn() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isLogin
+}
+
+func (s *session) setLogin(isLogin bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isLogin = isLogin
+}
+
+// reset drops all cookies and the login state.
+func (s *session) reset() {
+	jar, _ := cookiejar.New(nil)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jar = jar
+	s.isLogin = false
+}
@@ -0,0 +1,291 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// SkipDir is used as a return value from WalkDirFunc to indicate that the folder named in the call is to be skipped.
+// When returned for a file, the remaining files and folders in the containing folder are skipped.
+var SkipDir = errors.New("skip this folder")
+
+// WalkDirFunc is the type of the function called by WalkDir to visit each file and folder.
+//
+// curPath is the path of the folder containing the file or folder, it's empty for the root folder.
+// For a folder, share is the share information of the folder itself and the function is called before
+// the folder is listed, so returning SkipDir skips the folder without listing it.
+// For a file, share is the share information of the folder containing it.
+//
+// If the share information of a folder can not be fetched, the function is called with the error and a nil share.
+// If a folder can not be listed, the function is called a second time for that folder with the error.
+// In both cases returning nil or SkipDir skips the folder and the walk continues.
+// Any other error returned by the function stops the walk and is returned by WalkDir.
+type WalkDirFunc func(curPath string, share *Share, file *File, err error) error
+
+// Walk calls the handler for each file in the share, the walk stops and returns ErrWalkAbort
+// if the handler returns false.
+func (c *Client) Walk(shareID, folderID string, handler func(curPath string, share *Share, file *File) bool) error {
+	return c.WalkContext(context.Background(), shareID, folderID, handler)
+}
+
+// WalkContext is like Walk but with a context, the walk stops and returns ctx.Err() once the context is done.
+func (c *Client) WalkContext(ctx context.Context, shareID, folderID string, handler func(curPath string, share *Share, file *File) bool) error {
+	return c.WalkDir(ctx, shareID, folderID, walkFunc(handler))
+}
+
+// WalkConcurrent is like WalkContext but lists folders with the given count of workers concurrently,
+// see WalkDirConcurrent for the order of calls.
+func (c *Client) WalkConcurrent(ctx context.Context, shareID, folderID string, workers int, handler func(curPath string, share *Share, file *File) bool) error {
+	return c.WalkDirConcurrent(ctx, shareID, folderID, workers, walkFunc(handler))
+}
+
+// walkFunc adapts the handler of Walk to WalkDirFunc.
+func walkFunc(handler func(curPath string, share *Share, file *File) bool) WalkDirFunc {
+	return func(curPath string, share *Share, file *File, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.Type == TypeFile && !handler(curPath, share, file) {
+			return ErrWalkAbort
+		}
+		return nil
+	}
+}
+
+// WalkDir walks the share tree rooted at the folder depth-first, calling fn for each file and folder
+// including the root folder, in the order of the listing.
+// The walk stops and returns ctx.Err() once the context is done.
+func (c *Client) WalkDir(ctx context.Context, shareID, folderID string, fn WalkDirFunc) error {
+	err := c.walkDir(ctx, shareID, &File{Type: TypeFolder, ID: folderID}, "", fn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) walkDir(ctx context.Context, shareID string, folder *File, curPath string, fn WalkDirFunc) error {
+	share, err := c.GetShareInfoContext(ctx, shareID, folder.ID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return skipDir(fn(curPath, nil, folder, err))
+	}
+	rootEntry(share, folder)
+	if err := fn(curPath, share, folder, nil); err != nil {
+		return skipDir(err)
+	}
+	files, err := c.ParseFilesContext(ctx, share)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return skipDir(fn(curPath, share, folder, err))
+	}
+	dir := path.Join(curPath, share.FolderName)
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch file.Type {
+		case TypeFolder:
+			err = c.walkDir(ctx, shareID, file, dir, fn)
+		case TypeFile:
+			err = fn(dir, share, file, nil)
+		}
+		if err == SkipDir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipDir converts SkipDir returned for a folder to nil.
+func skipDir(err error) error {
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+// rootEntry fills the entry of the root folder, which is not from a listing.
+func rootEntry(share *Share, folder *File) {
+	if folder.Name == "" {
+		folder.Name = share.FolderName
+		folder.ID = strconv.Itoa(share.FolderID)
+		folder.Date = share.FolderTime
+		folder.parseMeta()
+	}
+}
+
+// WalkDirConcurrent is like WalkDir but lists folders with the given count of workers concurrently.
+// fn is never called concurrently, a folder is always visited before its contents, and files of a folder
+// are visited in the order of the listing, but the order between folders is not defined.
+// Folders are queued as they are listed, so returning SkipDir for a file skips the remaining files and folders
+// listed after it, while the folders listed before it have been queued and are still walked, maybe after the call.
+// Once fn returns an error other than SkipDir, the walk stops as soon as possible and returns the first error.
+func (c *Client) WalkDirConcurrent(ctx context.Context, shareID, folderID string, workers int, fn WalkDirFunc) error {
+	if workers <= 1 {
+		return c.WalkDir(ctx, shareID, folderID, fn)
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := &walker{
+		c:       c,
+		ctx:     wctx,
+		cancel:  cancel,
+		shareID: shareID,
+		fn:      fn,
+	}
+	w.cond = sync.NewCond(&w.qmu)
+	w.push(walkJob{folder: &File{Type: TypeFolder, ID: folderID}})
+	// wake up the idle workers once the walk is stopped.
+	go func() {
+		<-wctx.Done()
+		w.qmu.Lock()
+		w.cond.Broadcast()
+		w.qmu.Unlock()
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := w.next()
+				if !ok {
+					return
+				}
+				w.walk(job.folder, job.curPath)
+				w.done()
+			}
+		}()
+	}
+	wg.Wait()
+	if w.err != nil {
+		return w.err
+	}
+	return ctx.Err()
+}
+
+// walkJob is a folder waiting to be walked.
+type walkJob struct {
+	folder  *File
+	curPath string
+}
+
+type walker struct {
+	c       *Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	shareID string
+
+	// queue is the folders waiting for a worker, pending counts the folders queued or being walked.
+	qmu     sync.Mutex
+	cond    *sync.Cond
+	queue   []walkJob
+	pending int
+
+	// mu serializes the calls of fn.
+	mu sync.Mutex
+	fn WalkDirFunc
+
+	errOnce sync.Once
+	err     error
+}
+
+func (w *walker) fail(err error) {
+	w.errOnce.Do(func() {
+		w.err = err
+		w.cancel()
+	})
+}
+
+func (w *walker) push(job walkJob) {
+	w.qmu.Lock()
+	defer w.qmu.Unlock()
+	w.queue = append(w.queue, job)
+	w.pending++
+	w.cond.Signal()
+}
+
+// next waits for a queued folder, it returns false once all folders are walked or the walk is stopped.
+func (w *walker) next() (walkJob, bool) {
+	w.qmu.Lock()
+	defer w.qmu.Unlock()
+	for len(w.queue) == 0 && w.pending > 0 && w.ctx.Err() == nil {
+		w.cond.Wait()
+	}
+	if len(w.queue) == 0 || w.ctx.Err() != nil {
+		return walkJob{}, false
+	}
+	// the last queued folder is walked first to keep the queue short.
+	job := w.queue[len(w.queue)-1]
+	w.queue[len(w.queue)-1] = walkJob{}
+	w.queue = w.queue[:len(w.queue)-1]
+	return job, true
+}
+
+// done marks a folder returned by next as walked.
+func (w *walker) done() {
+	w.qmu.Lock()
+	defer w.qmu.Unlock()
+	w.pending--
+	if w.pending == 0 {
+		w.cond.Broadcast()
+	}
+}
+
+func (w *walker) walk(folder *File, curPath string) {
+	share, err := w.c.GetShareInfoContext(w.ctx, w.shareID, folder.ID)
+	if err != nil {
+		w.call(curPath, nil, folder, err)
+		return
+	}
+	rootEntry(share, folder)
+	if !w.call(curPath, share, folder, nil) {
+		return
+	}
+	files, err := w.c.ParseFilesContext(w.ctx, share)
+	if err != nil {
+		w.call(curPath, share, folder, err)
+		return
+	}
+	dir := path.Join(curPath, share.FolderName)
+	for _, file := range files {
+		switch file.Type {
+		case TypeFolder:
+			w.push(walkJob{folder: file, curPath: dir})
+		case TypeFile:
+			if !w.call(dir, share, file, nil) {
+				return
+			}
+		}
+	}
+}
+
+// call calls fn, it returns false if the folder should be skipped or the walk should stop.
+func (w *walker) call(curPath string, share *Share, file *File, err error) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ctx.Err() != nil {
+		return false
+	}
+	if err := w.fn(curPath, share, file, err); err != nil {
+		if err != SkipDir {
+			w.fail(err)
+		}
+		return false
+	}
+	// the error has been handled by fn.
+	return err == nil
+}
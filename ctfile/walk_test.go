@@ -0,0 +1,200 @@
+package ctfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/ctfile/ctfiletest"
+)
+
+func TestClient_Walk(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	var got []string
+	err := c.Walk("1-2-abc", "", func(curPath string, share *Share, file *File) bool {
+		got = append(got, path.Join(curPath, file.Name))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if want := []string{"root/a.txt", "root/sub/b.txt", "root/sub/deep/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() visited %v, want %v", got, want)
+	}
+
+	var count int
+	err = c.Walk("1-2-abc", "", func(curPath string, share *Share, file *File) bool {
+		count++
+		return false
+	})
+	if err != ErrWalkAbort || count != 1 {
+		t.Errorf("Walk() = %v after %d files, want %v after 1 file", err, count, ErrWalkAbort)
+	}
+}
+
+func TestClient_WalkContext(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	srv.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.WalkContext(ctx, "1-2-abc", "", func(curPath string, share *Share, file *File) bool {
+		return true
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("WalkContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClient_WalkConcurrent(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	srv.SetLatency(10 * time.Millisecond)
+	var (
+		got     []string
+		running bool
+	)
+	err := c.WalkConcurrent(context.Background(), "1-2-abc", "", 4, func(curPath string, share *Share, file *File) bool {
+		if running {
+			t.Error("handler is called concurrently")
+		}
+		running = true
+		time.Sleep(5 * time.Millisecond)
+		got = append(got, path.Join(curPath, file.Name))
+		running = false
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if want := []string{"root/a.txt", "root/sub/b.txt", "root/sub/deep/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkConcurrent() visited %v, want %v", got, want)
+	}
+
+	var count int
+	err = c.WalkConcurrent(context.Background(), "1-2-abc", "", 4, func(curPath string, share *Share, file *File) bool {
+		count++
+		return false
+	})
+	if err != ErrWalkAbort || count != 1 {
+		t.Errorf("WalkConcurrent() = %v after %d files, want %v after 1 file", err, count, ErrWalkAbort)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Millisecond)
+	defer cancel()
+	err = c.WalkConcurrent(ctx, "1-2-abc", "", 4, func(curPath string, share *Share, file *File) bool {
+		return true
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("WalkConcurrent() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClient_WalkDir(t *testing.T) {
+	srv, c := newTestServer()
+	defer srv.Close()
+	var got []string
+	err := c.WalkDir(context.Background(), "1-2-abc", "", func(curPath string, share *Share, file *File, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.Type == TypeFolder && share.FolderName != file.Name {
+			t.Errorf("share of folder %s is %s", file.Name, share.FolderName)
+		}
+		got = append(got, path.Join(curPath, file.Name))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"root", "root/sub", "root/sub/deep", "root/sub/deep/c.txt", "root/sub/b.txt", "root/empty", "root/a.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkDir() visited %v, want %v", got, want)
+	}
+}
+
+func TestClient_WalkDir_SkipDir(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		srv, c := newTestServer()
+		defer srv.Close()
+		var got []string
+		err := c.WalkDirConcurrent(context.Background(), "1-2-abc", "", workers, func(curPath string, share *Share, file *File, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, path.Join(curPath, file.Name))
+			if file.Name == "sub" {
+				return SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		if want := []string{"root", "root/a.txt", "root/empty", "root/sub"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("WalkDirConcurrent(%d) visited %v, want %v", workers, got, want)
+		}
+		// getdir and listing of root and empty, getdir of sub.
+		if n := srv.Requests(); n != 5 {
+			t.Errorf("WalkDirConcurrent(%d) sent %d requests, want 5", workers, n)
+		}
+	}
+}
+
+func TestClient_WalkDir_Error(t *testing.T) {
+	errStop := errors.New("stop")
+	for _, workers := range []int{1, 4} {
+		srv, c := newTestServer()
+		defer srv.Close()
+		err := c.WalkDirConcurrent(context.Background(), "1-2-abc", "", workers, func(curPath string, share *Share, file *File, err error) error {
+			if file.Name == "deep" {
+				return errStop
+			}
+			return err
+		})
+		if err != errStop {
+			t.Errorf("WalkDirConcurrent(%d) = %v, want %v", workers, err, errStop)
+		}
+	}
+}
+
+func TestClient_WalkDirConcurrent_Bounded(t *testing.T) {
+	srv := ctfiletest.NewServer()
+	defer srv.Close()
+	root := &ctfiletest.Folder{Name: "root"}
+	for i := 0; i < 200; i++ {
+		root.Folders = append(root.Folders, &ctfiletest.Folder{Name: fmt.Sprintf("%03d", i)})
+	}
+	srv.AddShare(&ctfiletest.Share{ID: "wide", Root: root})
+	c := NewClient(WithAPIEndpoint(srv.URL))
+
+	base := runtime.NumGoroutine()
+	var count, max int
+	err := c.WalkDirConcurrent(context.Background(), "wide", "", 4, func(curPath string, share *Share, file *File, err error) error {
+		count++
+		if n := runtime.NumGoroutine(); n > max {
+			max = n
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 201 {
+		t.Errorf("WalkDirConcurrent() visited %d folders, want 201", count)
+	}
+	// the workers, their connections and the connections of the server.
+	if max > base+50 {
+		t.Errorf("WalkDirConcurrent() ran %d goroutines, want at most %d", max, base+50)
+	}
+}
@@ -0,0 +1,271 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/aria2"
+)
+
+const aria2PollInterval = time.Second
+
+// aria2StatusKeys are the keys of aria2.tellStatus used by convertStatus.
+var aria2StatusKeys = []string{"gid", "status", "totalLength", "completedLength", "errorMessage"}
+
+type aria2Downloader struct {
+	c        *aria2.Client
+	dir      string
+	events   *EventQueue
+	interval time.Duration
+	// ctx is canceled by Close, which aborts the refreshing in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// unsubscribe is nil if the notifications are not supported, the states are polled then.
+	unsubscribe func()
+
+	// mu guards states, and it's held by Add until the download is watched,
+	// so a notification of the download is not handled before that.
+	mu sync.Mutex
+	// states are the last states of the downloads added by Add and not finished yet.
+	states map[string]State
+
+	changedMu sync.Mutex
+	// changed are the downloads to refresh by the notifications, nil means all downloads.
+	changed map[string]bool
+	wake    chan struct{}
+}
+
+// NewAria2Downloader returns a Downloader adding the downloads to aria2 with the directory.
+// The events are sent by the notifications of aria2 if the client uses the websocket transport,
+// otherwise the states of the downloads are polled every second. The client is closed by Close.
+func NewAria2Downloader(c *aria2.Client, dir string) Downloader {
+	return newAria2Downloader(c, dir, aria2PollInterval)
+}
+
+func newAria2Downloader(c *aria2.Client, dir string, interval time.Duration) *aria2Downloader {
+	d := &aria2Downloader{
+		c:        c,
+		dir:      dir,
+		events:   NewEventQueue(),
+		interval: interval,
+		states:   make(map[string]State),
+		changed:  make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	if unsubscribe, err := c.Subscribe(d.notified); err == nil {
+		d.unsubscribe = unsubscribe
+	}
+	d.wg.Add(1)
+	go d.poll()
+	return d
+}
+
+// notified marks the download of the notification to refresh, all downloads are refreshed on reconnection.
+func (d *aria2Downloader) notified(n *aria2.Notification) {
+	d.changedMu.Lock()
+	switch {
+	case n.Event == aria2.EventReconnected:
+		d.changed = nil
+	case d.changed != nil:
+		d.changed[n.Gid] = true
+	}
+	d.changedMu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *aria2Downloader) Add(ctx context.Context, req *Request) (string, error) {
+	if err := CheckPath(req.Path); err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var (
+		gid string
+		err error
+	)
+	if d.dir != "" {
+		gid, err = d.c.AddUriContext(ctx, req.URLs, aria2.Output(req.Path), aria2.Directory(d.dir))
+	} else {
+		gid, err = d.c.AddUriContext(ctx, req.URLs, aria2.Output(req.Path))
+	}
+	if err != nil {
+		return "", err
+	}
+	d.states[gid] = StateWaiting
+	d.events.Send(Event{ID: gid, State: StateWaiting})
+	return gid, nil
+}
+
+// isNotFound reports whether the error is returned by aria2 for an unknown gid, which is "GID ... is not found"
+// with code 1, other errors like a broken connection or a bad parameter are not.
+func isNotFound(err error) bool {
+	var rpcErr *aria2.Error
+	return errors.As(err, &rpcErr) && rpcErr.Code == 1 &&
+		strings.HasPrefix(rpcErr.Message, "GID ") && strings.HasSuffix(rpcErr.Message, " is not found")
+}
+
+func (d *aria2Downloader) Status(ctx context.Context, id string) (*Status, error) {
+	status, err := d.c.TellStatusContext(ctx, id, aria2StatusKeys...)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return convertStatus(status), nil
+}
+
+func convertStatus(status *aria2.TaskStatus) *Status {
+	s := &Status{
+		ID:        status.Gid,
+		Completed: int64(status.CompletedLength),
+		Total:     int64(status.TotalLength),
+	}
+	// aria2 reports 0 before the length is known.
+	if s.Total == 0 && status.Status != aria2.StatusComplete {
+		s.Total = -1
+	}
+	switch status.Status {
+	case aria2.StatusActive:
+		s.State = StateActive
+	case aria2.StatusPaused:
+		s.State = StatePaused
+	case aria2.StatusComplete:
+		s.State = StateComplete
+	case aria2.StatusError:
+		s.State = StateError
+		s.Err = errors.New(status.ErrorMessage)
+	case aria2.StatusRemoved:
+		s.State = StateCanceled
+	default:
+		s.State = StateWaiting
+	}
+	return s
+}
+
+func (d *aria2Downloader) Cancel(ctx context.Context, id string) error {
+	if err := d.c.RemoveContext(ctx, id); isNotFound(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	d.update(id, StateCanceled, nil)
+	return nil
+}
+
+func (d *aria2Downloader) Pause(ctx context.Context, id string) error {
+	if err := d.c.PauseContext(ctx, id); isNotFound(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	d.update(id, StatePaused, nil)
+	return nil
+}
+
+func (d *aria2Downloader) Resume(ctx context.Context, id string) error {
+	if err := d.c.UnpauseContext(ctx, id); isNotFound(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	d.update(id, StateWaiting, nil)
+	return nil
+}
+
+// update sends the event if the state of the watched download changes, the finished one is unwatched.
+func (d *aria2Downloader) update(id string, state State, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last, ok := d.states[id]
+	if !ok || last == state {
+		return
+	}
+	if state.Finished() {
+		delete(d.states, id)
+	} else {
+		d.states[id] = state
+	}
+	d.events.Send(Event{ID: id, State: state, Err: err})
+}
+
+// poll refreshes the states of the notified downloads, or all watched downloads every interval
+// if the notifications are not supported.
+func (d *aria2Downloader) poll() {
+	defer d.wg.Done()
+	var tick <-chan time.Time
+	if d.unsubscribe == nil {
+		t := time.NewTicker(d.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-tick:
+			d.refresh(nil)
+		case <-d.wake:
+			d.changedMu.Lock()
+			changed := d.changed
+			d.changed = make(map[string]bool)
+			d.changedMu.Unlock()
+			d.refresh(changed)
+		}
+	}
+}
+
+// refresh refreshes the states of the watched downloads in changed, nil means all.
+// The refreshing is skipped if the request fails, it's retried by the next polling or notification.
+func (d *aria2Downloader) refresh(changed map[string]bool) {
+	d.mu.Lock()
+	ids := make([]string, 0, len(d.states))
+	for id := range d.states {
+		if changed == nil || changed[id] {
+			ids = append(ids, id)
+		}
+	}
+	d.mu.Unlock()
+	// all states are refreshed in one request.
+	batch := d.c.Batch()
+	for _, id := range ids {
+		batch.TellStatus(id, aria2StatusKeys...)
+	}
+	results, err := batch.DoContext(d.ctx)
+	if err != nil {
+		return
+	}
+	for i, result := range results {
+		switch {
+		case isNotFound(result.Err):
+			// the download is gone from aria2 without being removed, e.g. aria2 is restarted without a session.
+			d.update(ids[i], StateCanceled, ErrNotFound)
+		case result.Err == nil:
+			s := convertStatus(result.Value.(*aria2.TaskStatus))
+			d.update(ids[i], s.State, s.Err)
+		}
+	}
+}
+
+func (d *aria2Downloader) Events() <-chan Event {
+	return d.events.C()
+}
+
+// Close stops watching the downloads and closes the client, the downloads keep running in aria2.
+func (d *aria2Downloader) Close() error {
+	if d.unsubscribe != nil {
+		d.unsubscribe()
+	}
+	d.cancel()
+	d.wg.Wait()
+	d.events.Close()
+	return d.c.Close()
+}
@@ -0,0 +1,194 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned by a Downloader for an unknown id.
+	ErrNotFound = errors.New("download not found")
+	// ErrUnsafePath is returned by a Downloader for the path of a Request which may escape the directory.
+	ErrUnsafePath = errors.New("unsafe path")
+)
+
+// State is the state of a download of a Downloader.
+type State string
+
+const (
+	// StateWaiting for the downloads in the queue.
+	StateWaiting State = "waiting"
+	// StateActive for the downloads in progress.
+	StateActive State = "active"
+	// StatePaused for the downloads paused by Pause.
+	StatePaused State = "paused"
+	// StateComplete for the completed downloads.
+	StateComplete State = "complete"
+	// StateError for the downloads stopped because of an error.
+	StateError State = "error"
+	// StateCanceled for the downloads canceled by Cancel or removed from the backend,
+	// or gone from the backend unexpectedly, which has the error in the Event.
+	StateCanceled State = "canceled"
+)
+
+// Finished reports whether the state is final, a finished download never changes its state.
+func (s State) Finished() bool {
+	return s == StateComplete || s == StateError || s == StateCanceled
+}
+
+// Request is a file to download.
+type Request struct {
+	// Path is the slash-separated path of the file relative to the directory of the Downloader,
+	// it must pass CheckPath.
+	Path string
+	// URLs are mirrors of the same file.
+	URLs []string
+}
+
+// Status is the progress of a download.
+type Status struct {
+	ID    string
+	State State
+	// Completed and Total are in bytes, Total is -1 if it's unknown.
+	Completed int64
+	Total     int64
+	// Err is the error of the download in StateError.
+	Err error
+}
+
+// Event is sent by a Downloader when the state of a download changes.
+type Event struct {
+	ID    string
+	State State
+	// Err is the error of the download in StateError, or the reason of the download in StateCanceled
+	// which is not canceled explicitly, e.g. ErrNotFound if it's gone from the backend.
+	Err error
+}
+
+// Downloader is a backend of downloads, like the native Engine or aria2.
+type Downloader interface {
+	// Add starts downloading the request and returns the id of the download.
+	Add(ctx context.Context, req *Request) (string, error)
+	// Status returns the progress of the download, or ErrNotFound if it's unknown.
+	// A finished download may be forgotten once its final event is sent.
+	Status(ctx context.Context, id string) (*Status, error)
+	// Cancel stops the download, its state becomes StateCanceled.
+	Cancel(ctx context.Context, id string) error
+	// Pause stops the download until Resume, the downloaded part is kept.
+	Pause(ctx context.Context, id string) error
+	// Resume continues the paused download.
+	Resume(ctx context.Context, id string) error
+	// Events returns the channel of the state changes of all downloads, it's closed by Close.
+	// The events are queued until they are received, so the channel should be drained.
+	Events() <-chan Event
+	// Close stops watching the downloads, the downloads of the native backend are stopped as well.
+	Close() error
+}
+
+// CheckPath returns ErrUnsafePath if the slash-separated path is absolute, or any element of it is empty,
+// "." or "..", or contains a backslash or a volume name of the local file system.
+// The names from a remote share should be checked before they are downloaded.
+func CheckPath(p string) error {
+	if p == "" || strings.HasPrefix(p, "/") {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, p)
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == "" || elem == "." || elem == ".." || strings.Contains(elem, `\`) || filepath.VolumeName(elem) != "" {
+			return fmt.Errorf("%w: %q", ErrUnsafePath, p)
+		}
+	}
+	return nil
+}
+
+// localPath returns the local path of the slash-separated path in the directory,
+// it fails if the path is unsafe or the local path is not under the directory.
+func localPath(dir, p string) (string, error) {
+	if err := CheckPath(p); err != nil {
+		return "", err
+	}
+	local := filepath.Join(dir, filepath.FromSlash(p))
+	rel, err := filepath.Rel(filepath.Join(dir, "."), local)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, p)
+	}
+	return local, nil
+}
+
+// EventQueue delivers events to a channel in order without blocking the sender, for implementations of Downloader.
+type EventQueue struct {
+	ch chan Event
+
+	mu      sync.Mutex
+	pending []Event
+	notify  chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+func NewEventQueue() *EventQueue {
+	q := &EventQueue{
+		ch:     make(chan Event),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go q.loop()
+	return q
+}
+
+func (q *EventQueue) loop() {
+	defer close(q.ch)
+	for {
+		q.mu.Lock()
+		events := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+		for _, ev := range events {
+			select {
+			case q.ch <- ev:
+			case <-q.done:
+				return
+			}
+		}
+		if len(events) == 0 {
+			select {
+			case <-q.notify:
+			case <-q.done:
+				return
+			}
+		}
+	}
+}
+
+// Send queues the event, it's dropped if the queue is closed.
+func (q *EventQueue) Send(ev Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.pending = append(q.pending, ev)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// C returns the channel of the events.
+func (q *EventQueue) C() <-chan Event {
+	return q.ch
+}
+
+// Close closes the channel, the events not received yet are dropped.
+func (q *EventQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+}
@@ -0,0 +1,313 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hr3lxphr6j/ctfile/aria2"
+	"github.com/hr3lxphr6j/ctfile/aria2/aria2test"
+)
+
+// nextEvent returns the next event of the downloader, the test fails if there is none in 5 seconds.
+func nextEvent(t *testing.T, d Downloader) Event {
+	t.Helper()
+	select {
+	case ev := <-d.Events():
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event is received")
+		return Event{}
+	}
+}
+
+// waitState receives the events until the download is in the state.
+func waitState(t *testing.T, d Downloader, id string, state State) Event {
+	t.Helper()
+	for {
+		ev := nextEvent(t, d)
+		if ev.ID == id && ev.State == state {
+			return ev
+		}
+		if ev.ID == id && ev.State.Finished() {
+			t.Fatalf("download %s is %s, err: %v, want %s", id, ev.State, ev.Err, state)
+		}
+	}
+}
+
+func TestNativeDownloader(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	d := NewNativeDownloader(NewEngine(WithMinSegmentSize(1<<10)), dir)
+	defer d.Close()
+
+	id, err := d.Add(ctx, &Request{Path: "a/file.bin", URLs: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateComplete)
+	checkFile(t, filepath.Join(dir, "a", "file.bin"), srv.content)
+	// the finished download is forgotten.
+	if _, err := d.Status(ctx, id); err != ErrNotFound {
+		t.Errorf("Status() of the complete download = %v, want %v", err, ErrNotFound)
+	}
+
+	bad := newTestServer(0)
+	defer bad.Close()
+	bad.failing = true
+	id, err = d.Add(ctx, &Request{Path: "bad", URLs: []string{bad.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitState(t, d, id, StateError); ev.Err == nil {
+		t.Error("event of the failed download has no error")
+	}
+	if _, err := d.Status(ctx, "unknown"); err != ErrNotFound {
+		t.Errorf("Status() of unknown id = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestNativeDownloader_UnsafePath(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	d := NewNativeDownloader(NewEngine(), filepath.Join(dir, "output"))
+	defer d.Close()
+	for _, path := range []string{"../../.bashrc", "a/../../b", "/etc/passwd", "a//b", "./a", `a\..\..\b`, ""} {
+		if _, err := d.Add(context.Background(), &Request{Path: path, URLs: []string{"http://127.0.0.1/"}}); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("Add(%q) = %v, want %v", path, err, ErrUnsafePath)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output")); !os.IsNotExist(err) {
+		t.Errorf("output directory is created by the unsafe paths, err: %v", err)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := filepath.Join("out", "dir")
+	local, err := localPath(dir, "a/b.bin")
+	if want := filepath.Join(dir, "a", "b.bin"); err != nil || local != want {
+		t.Errorf("localPath() = %q, %v, want %q", local, err, want)
+	}
+	if _, err := localPath(dir, "a/../../b"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("localPath() = %v, want %v", err, ErrUnsafePath)
+	}
+}
+
+func TestNativeDownloader_Pause(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	d := NewNativeDownloader(NewEngine(WithMinSegmentSize(1<<10), WithBandwidth(128<<10)), dir)
+	defer d.Close()
+
+	id, err := d.Add(ctx, &Request{Path: "file.bin", URLs: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateActive)
+	time.Sleep(100 * time.Millisecond)
+	if err := d.Pause(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StatePaused)
+	if _, err := os.Stat(filepath.Join(dir, "file.bin.part.json")); err != nil {
+		t.Errorf("state of the paused download is not saved, err: %v", err)
+	}
+	if err := d.Resume(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateComplete)
+	checkFile(t, filepath.Join(dir, "file.bin"), srv.content)
+
+	id, err = d.Add(ctx, &Request{Path: "canceled.bin", URLs: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Cancel(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateCanceled)
+	if err := d.Resume(ctx, id); err != ErrNotFound {
+		t.Errorf("Resume() of the canceled download = %v, want %v", err, ErrNotFound)
+	}
+
+	// Resume of an active download returns without waiting for it.
+	id, err = d.Add(ctx, &Request{Path: "active.bin", URLs: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := d.Resume(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Resume() of an active download returned after %s", elapsed)
+	}
+	if status, _ := d.Status(ctx, id); status.State != StateActive {
+		t.Errorf("state of the active download after Resume = %s", status.State)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&aria2.Error{Code: 1, Message: "GID 2089b05ecca3d829 is not found"}, true},
+		{&aria2.Error{Code: 1, Message: "Unauthorized"}, false},
+		{&aria2.Error{Code: 1, Message: "GID#2089b05ecca3d829 cannot be paused now"}, false},
+		{&aria2.Error{Code: 2, Message: "GID 2089b05ecca3d829 is not found"}, false},
+		{errors.New("GID 2089b05ecca3d829 is not found"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := isNotFound(test.err); got != test.want {
+			t.Errorf("isNotFound(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestAria2Downloader(t *testing.T) {
+	srv := aria2test.NewServer("secret")
+	defer srv.Close()
+	// the websocket transport is push-based, so the states are never polled.
+	for name, endpoint := range map[string]string{"http": srv.Endpoint(), "websocket": srv.WSEndpoint()} {
+		t.Run(name, func(t *testing.T) {
+			c := aria2.New(endpoint, "secret")
+			defer c.Close()
+			interval := 10 * time.Millisecond
+			if name == "websocket" {
+				interval = time.Hour
+			}
+			d := newAria2Downloader(c, "/data", interval)
+			defer d.Close()
+			testAria2Downloader(t, srv, d)
+		})
+	}
+}
+
+func testAria2Downloader(t *testing.T, srv *aria2test.Server, d Downloader) {
+	ctx := context.Background()
+	id, err := d.Add(ctx, &Request{Path: "a/file.bin", URLs: []string{"http://example.com/file.bin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := srv.Task(id); task.Options["out"] != "a/file.bin" || task.Options["dir"] != "/data" {
+		t.Errorf("options of aria2.addUri = %v", task.Options)
+	}
+	waitState(t, d, id, StateWaiting)
+	if status, err := d.Status(ctx, id); err != nil || status.Total != -1 {
+		t.Errorf("Status() of unknown length = %+v, %v, want Total -1", status, err)
+	}
+	srv.SetStatus(id, aria2test.StatusActive, "")
+	waitState(t, d, id, StateActive)
+	if err := d.Pause(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StatePaused)
+	if err := d.Resume(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateWaiting)
+	srv.SetStatus(id, aria2test.StatusComplete, "")
+	waitState(t, d, id, StateComplete)
+	status, err := d.Status(ctx, id)
+	if err != nil || status.State != StateComplete {
+		t.Errorf("Status() = %+v, %v, want complete", status, err)
+	}
+
+	id, _ = d.Add(ctx, &Request{Path: "b", URLs: []string{"http://example.com/b"}})
+	srv.SetStatus(id, aria2test.StatusError, "network problem")
+	if ev := waitState(t, d, id, StateError); ev.Err == nil || ev.Err.Error() != "network problem" {
+		t.Errorf("error of the failed download = %v", ev.Err)
+	}
+
+	// the download removed by another client is canceled.
+	id, _ = d.Add(ctx, &Request{Path: "c", URLs: []string{"http://example.com/c"}})
+	srv.SetStatus(id, aria2test.StatusRemoved, "")
+	if ev := waitState(t, d, id, StateCanceled); ev.Err != nil {
+		t.Errorf("error of the removed download = %v, want nil", ev.Err)
+	}
+	srv.Delete(id)
+	if _, err := d.Status(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Status() of the deleted download = %v, want %v", err, ErrNotFound)
+	}
+	if err := d.Cancel(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel() of the deleted download = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestAria2Downloader_Reconnect(t *testing.T) {
+	srv := aria2test.NewServer("")
+	defer srv.Close()
+	c := aria2.New(srv.WSEndpoint(), "")
+	defer c.Close()
+	d := newAria2Downloader(c, "", time.Hour)
+	defer d.Close()
+	ctx := context.Background()
+	id, err := d.Add(ctx, &Request{Path: "a", URLs: []string{"http://example.com/a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateWaiting)
+	// the notification is lost while disconnected, the state is refreshed after reconnected.
+	srv.DropConnections()
+	srv.SetStatus(id, aria2test.StatusComplete, "")
+	waitState(t, d, id, StateComplete)
+
+	// the websocket of the client is closed with the downloader.
+	d.Close()
+	if _, err := c.TellStatus(id); err != aria2.ErrConnectionClosed {
+		t.Errorf("TellStatus() after Close() = %v, want %v", err, aria2.ErrConnectionClosed)
+	}
+}
+
+func TestAria2Downloader_Refresh(t *testing.T) {
+	srv := aria2test.NewServer("")
+	defer srv.Close()
+	d := newAria2Downloader(aria2.New(srv.Endpoint(), ""), "", time.Hour)
+	defer d.Close()
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"a", "b", "c"} {
+		id, err := d.Add(ctx, &Request{Path: name, URLs: []string{"http://example.com/" + name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitState(t, d, id, StateWaiting)
+		srv.SetStatus(id, aria2test.StatusComplete, "")
+		ids = append(ids, id)
+	}
+	requests := srv.Requests()
+	d.refresh(nil)
+	if n := srv.Requests() - requests; n != 1 {
+		t.Errorf("refresh() of %d downloads sends %d requests, want 1", len(ids), n)
+	}
+	// the events are in any order.
+	complete := make(map[string]bool)
+	for len(complete) < len(ids) {
+		if ev := nextEvent(t, d); ev.State == StateComplete {
+			complete[ev.ID] = true
+		}
+	}
+
+	// the download gone from aria2 is canceled with the error.
+	id, err := d.Add(ctx, &Request{Path: "d", URLs: []string{"http://example.com/d"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, id, StateWaiting)
+	srv.Delete(id)
+	d.refresh(nil)
+	if ev := waitState(t, d, id, StateCanceled); !errors.Is(ev.Err, ErrNotFound) {
+		t.Errorf("error of the gone download = %v, want %v", ev.Err, ErrNotFound)
+	}
+}
@@ -0,0 +1,172 @@
+// Package downloadtest provides an in-memory fake of download.Downloader for tests.
+package downloadtest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/hr3lxphr6j/ctfile/download"
+)
+
+// Downloader is a fake download.Downloader, the downloads stay active until they are finished by
+// Complete or Fail, unless AutoComplete is set.
+type Downloader struct {
+	events *download.EventQueue
+
+	mu       sync.Mutex
+	lastID   int
+	requests []*download.Request
+	tasks    map[string]*task
+	// autoComplete completes the downloads once they are added.
+	autoComplete bool
+	// addErr is returned by Add if it's not nil.
+	addErr error
+}
+
+type task struct {
+	req    *download.Request
+	status download.Status
+}
+
+func NewDownloader() *Downloader {
+	return &Downloader{
+		events: download.NewEventQueue(),
+		tasks:  make(map[string]*task),
+	}
+}
+
+// SetAutoComplete makes the downloads complete once they are added.
+func (d *Downloader) SetAutoComplete(auto bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.autoComplete = auto
+}
+
+// SetAddError makes Add return the error, nil resets it.
+func (d *Downloader) SetAddError(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addErr = err
+}
+
+// Requests returns the requests added so far in order.
+func (d *Downloader) Requests() []*download.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*download.Request(nil), d.requests...)
+}
+
+// ID returns the id of the latest download of the path, ok is false if it's not added.
+func (d *Downloader) ID(path string) (id string, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := len(d.requests) - 1; i >= 0; i-- {
+		if d.requests[i].Path == path {
+			return strconv.Itoa(i + 1), true
+		}
+	}
+	return "", false
+}
+
+// Complete finishes the download successfully.
+func (d *Downloader) Complete(id string) error {
+	return d.finish(id, download.StateComplete, nil)
+}
+
+// Fail finishes the download with the error.
+func (d *Downloader) Fail(id string, err error) error {
+	return d.finish(id, download.StateError, err)
+}
+
+func (d *Downloader) finish(id string, state download.State, err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.tasks[id]
+	if !ok {
+		return download.ErrNotFound
+	}
+	if !t.status.State.Finished() {
+		d.setState(id, t, state, err)
+	}
+	return nil
+}
+
+// setState changes the state of the task and sends the event, it must be called with mu held.
+func (d *Downloader) setState(id string, t *task, state download.State, err error) {
+	t.status.State, t.status.Err = state, err
+	if state == download.StateComplete && t.status.Total >= 0 {
+		t.status.Completed = t.status.Total
+	}
+	d.events.Send(download.Event{ID: id, State: state, Err: err})
+}
+
+func (d *Downloader) Add(ctx context.Context, req *download.Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.addErr != nil {
+		return "", d.addErr
+	}
+	d.lastID++
+	id := strconv.Itoa(d.lastID)
+	d.requests = append(d.requests, req)
+	t := &task{req: req, status: download.Status{ID: id, Total: -1}}
+	d.tasks[id] = t
+	d.setState(id, t, download.StateActive, nil)
+	if d.autoComplete {
+		d.setState(id, t, download.StateComplete, nil)
+	}
+	return id, nil
+}
+
+func (d *Downloader) Status(ctx context.Context, id string) (*download.Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.tasks[id]
+	if !ok {
+		return nil, download.ErrNotFound
+	}
+	status := t.status
+	return &status, nil
+}
+
+// transit changes the state of the unfinished download.
+func (d *Downloader) transit(id string, from []download.State, to download.State) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.tasks[id]
+	if !ok {
+		return download.ErrNotFound
+	}
+	for _, state := range from {
+		if t.status.State == state {
+			d.setState(id, t, to, nil)
+			break
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) Cancel(ctx context.Context, id string) error {
+	return d.transit(id, []download.State{download.StateActive, download.StatePaused}, download.StateCanceled)
+}
+
+func (d *Downloader) Pause(ctx context.Context, id string) error {
+	return d.transit(id, []download.State{download.StateActive}, download.StatePaused)
+}
+
+func (d *Downloader) Resume(ctx context.Context, id string) error {
+	return d.transit(id, []download.State{download.StatePaused}, download.StateActive)
+}
+
+func (d *Downloader) Events() <-chan download.Event {
+	return d.events.C()
+}
+
+func (d *Downloader) Close() error {
+	d.events.Close()
+	return nil
+}
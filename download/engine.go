@@ -0,0 +1,416 @@
+// Package download provides a native multi-connection http downloader.
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/hr3lxphr6j/ctfile/utils"
+)
+
+const (
+	defaultConnections = 4
+	defaultMinSegment  = 1 << 20
+	defaultRetries     = 3
+	bufferSize         = 32 << 10
+)
+
+// Engine downloads files over http with multiple range requests, it's safe for concurrent use.
+//
+// A file is downloaded to the ".part" file next to it, with the progress saved in the ".part.json" state file,
+// so an interrupted download is resumed by the next Download of the same path.
+type Engine struct {
+	hc          *http.Client
+	userAgent   string
+	connections int
+	minSegment  int64
+	retries     int
+	// conns limits the connections of all downloads, nil means unlimited.
+	conns     chan struct{}
+	bandwidth *bandwidth
+	progress  func(path string, completed, total int64)
+}
+
+type Option func(*Engine)
+
+// WithHTTPClient sets the http client used by Engine, default is http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(e *Engine) {
+		e.hc = hc
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(ua string) Option {
+	return func(e *Engine) {
+		e.userAgent = ua
+	}
+}
+
+// WithConnections sets the max count of connections of a file, default is 4.
+func WithConnections(n int) Option {
+	return func(e *Engine) {
+		if n > 0 {
+			e.connections = n
+		}
+	}
+}
+
+// WithMaxConnections sets the max count of connections of all downloads, default is unlimited.
+func WithMaxConnections(n int) Option {
+	return func(e *Engine) {
+		if n > 0 {
+			e.conns = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithMinSegmentSize sets the min size of a segment downloaded by a connection, default is 1 MiB,
+// so a small file is downloaded with less connections.
+func WithMinSegmentSize(size int64) Option {
+	return func(e *Engine) {
+		if size > 0 {
+			e.minSegment = size
+		}
+	}
+}
+
+// WithRetries sets the count of retries of a failed segment, each retry uses the next url, default is 3.
+func WithRetries(n int) Option {
+	return func(e *Engine) {
+		if n >= 0 {
+			e.retries = n
+		}
+	}
+}
+
+// WithBandwidth limits the total download speed of all downloads in bytes per second, default is unlimited.
+func WithBandwidth(bytesPerSecond int64) Option {
+	return func(e *Engine) {
+		if bytesPerSecond > 0 {
+			e.bandwidth = newBandwidth(bytesPerSecond)
+		}
+	}
+}
+
+// WithProgress sets the function called with the completed bytes of the file after each write,
+// total is -1 if the size is unknown. It may be called concurrently for different files.
+func WithProgress(fn func(path string, completed, total int64)) Option {
+	return func(e *Engine) {
+		e.progress = fn
+	}
+}
+
+func NewEngine(opts ...Option) *Engine {
+	e := &Engine{
+		hc:          http.DefaultClient,
+		connections: defaultConnections,
+		minSegment:  defaultMinSegment,
+		retries:     defaultRetries,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Download downloads the file of the urls to the path, the urls should be mirrors of the same file,
+// segments are spread over them and a failed segment is retried with the next one.
+// The partial download is kept if it fails or the context is done, and resumed by the next call.
+func (e *Engine) Download(ctx context.Context, path string, urls ...string) error {
+	return e.download(ctx, path, e.progress, urls)
+}
+
+// download is Download with the progress function of the file.
+func (e *Engine) download(ctx context.Context, path string, progress func(path string, completed, total int64), urls []string) error {
+	if len(urls) == 0 {
+		return errors.New("no url")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	size, ranged, err := e.probe(ctx, urls)
+	if err != nil {
+		return err
+	}
+	partPath, statePath := path+".part", path+".part.json"
+	st := loadState(statePath, partPath, size)
+	if st == nil || !ranged {
+		st = newState(size, e.segments(size, ranged))
+	}
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	// the file of unknown size is written from the beginning, drop the previous content.
+	length := size
+	if length < 0 {
+		length = 0
+	}
+	if err := f.Truncate(length); err != nil {
+		f.Close()
+		return err
+	}
+	d := &fileDownload{e: e, path: path, urls: urls, ranged: ranged, f: f, st: st, progress: progress}
+	err = d.run(ctx, statePath)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if ranged {
+			st.save(statePath)
+		}
+		return err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	return nil
+}
+
+// probe requests the first byte to learn the size of the file and whether range requests are supported.
+func (e *Engine) probe(ctx context.Context, urls []string) (size int64, ranged bool, err error) {
+	for _, url := range urls {
+		var resp *http.Response
+		resp, err = e.get(ctx, url, "bytes=0-0")
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, false, err
+			}
+			continue
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+			// the range of an empty file is not satisfiable.
+			if size, ok := utils.ParseContentRange(resp.Header.Get("Content-Range")); ok {
+				return size, true, nil
+			}
+		case http.StatusOK:
+			return resp.ContentLength, false, nil
+		}
+		err = fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+	}
+	return 0, false, err
+}
+
+// segments splits the file to the segments downloaded by each connection.
+func (e *Engine) segments(size int64, ranged bool) int {
+	if !ranged || size <= 0 {
+		return 1
+	}
+	n := (size + e.minSegment - 1) / e.minSegment
+	if n > int64(e.connections) {
+		n = int64(e.connections)
+	}
+	return int(n)
+}
+
+// get sends a GET request with the Range header if it's not empty.
+func (e *Engine) get(ctx context.Context, url, rng string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if e.userAgent != "" {
+		req.Header.Set("User-Agent", e.userAgent)
+	}
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	return e.hc.Do(req)
+}
+
+func (e *Engine) acquire(ctx context.Context) error {
+	if e.conns == nil {
+		return nil
+	}
+	select {
+	case e.conns <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Engine) release() {
+	if e.conns != nil {
+		<-e.conns
+	}
+}
+
+// fileDownload is a running download of a file.
+type fileDownload struct {
+	e      *Engine
+	path   string
+	urls   []string
+	ranged bool
+	f      *os.File
+
+	progress func(path string, completed, total int64)
+
+	// mu guards the progress of st.
+	mu sync.Mutex
+	st *state
+}
+
+// run downloads the unfinished segments concurrently and saves the state every second.
+func (d *fileDownload) run(ctx context.Context, statePath string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+	)
+	for i, seg := range d.st.Segments {
+		if seg.finished() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, seg *segment) {
+			defer wg.Done()
+			if e := d.fetch(ctx, seg, i); e != nil {
+				errOnce.Do(func() {
+					err = e
+					cancel()
+				})
+			}
+		}(i, seg)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return err
+		case <-t.C:
+			if d.ranged {
+				d.mu.Lock()
+				d.st.save(statePath)
+				d.mu.Unlock()
+			}
+		}
+	}
+}
+
+// fetch downloads the segment, the url of the i-th segment is the i-th one, and the next one is used on retry.
+func (d *fileDownload) fetch(ctx context.Context, seg *segment, i int) error {
+	for attempt := 0; ; attempt++ {
+		err := d.fetchOnce(ctx, seg, d.urls[(i+attempt)%len(d.urls)])
+		if err == nil || ctx.Err() != nil || attempt >= d.e.retries {
+			return err
+		}
+	}
+}
+
+func (d *fileDownload) fetchOnce(ctx context.Context, seg *segment, url string) error {
+	if err := d.e.acquire(ctx); err != nil {
+		return err
+	}
+	defer d.e.release()
+	d.mu.Lock()
+	offset := seg.Start + seg.Done
+	d.mu.Unlock()
+	var rng string
+	if d.ranged {
+		rng = fmt.Sprintf("bytes=%d-%d", offset, seg.End-1)
+	} else {
+		// the download starts over without range requests.
+		offset = 0
+		d.mu.Lock()
+		seg.Done = 0
+		d.mu.Unlock()
+	}
+	resp, err := d.e.get(ctx, url, rng)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case d.ranged && resp.StatusCode == http.StatusOK:
+		return fmt.Errorf("range request is not supported by %s", url)
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		return fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+	}
+	buf := make([]byte, bufferSize)
+	for {
+		chunk := buf
+		if d.e.bandwidth != nil {
+			if err := d.e.bandwidth.wait(ctx); err != nil {
+				return err
+			}
+			chunk = buf[:d.e.bandwidth.chunk]
+		}
+		if seg.End >= 0 && int64(len(chunk)) > seg.End-offset {
+			chunk = chunk[:seg.End-offset]
+		}
+		n, err := resp.Body.Read(chunk)
+		if n > 0 {
+			if _, err := d.f.WriteAt(chunk[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+			d.advance(seg, int64(n))
+		}
+		if seg.End >= 0 && offset >= seg.End {
+			return nil
+		}
+		if err == io.EOF {
+			if seg.End < 0 {
+				return nil
+			}
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *fileDownload) advance(seg *segment, n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seg.Done += n
+	if d.progress != nil {
+		d.progress(d.path, d.st.completed(), d.st.Size)
+	}
+}
+
+// bandwidth limits the download speed by taking a chunk of bytes from the limiter for every read.
+type bandwidth struct {
+	rl    *rate.Limiter
+	chunk int
+}
+
+func newBandwidth(bytesPerSecond int64) *bandwidth {
+	// at least 10 chunks per second to keep the speed smooth.
+	chunk := int64(bufferSize)
+	if bytesPerSecond < chunk*10 {
+		chunk = bytesPerSecond / 10
+		if chunk < 1 {
+			chunk = 1
+		}
+	}
+	return &bandwidth{rl: rate.NewLimiter(rate.Limit(bytesPerSecond), int(chunk)), chunk: int(chunk)}
+}
+
+// wait takes a chunk of bytes from the limiter, the chunk is given back if the context is done before that.
+func (b *bandwidth) wait(ctx context.Context) error {
+	return utils.WaitN(ctx, b.rl, b.chunk)
+}
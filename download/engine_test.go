@@ -0,0 +1,288 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer serves the content with range requests, and counts the requests and the bytes sent.
+type testServer struct {
+	*httptest.Server
+	content  []byte
+	requests int64
+	sent     int64
+	running  int64
+	peak     int64
+	mu       sync.Mutex
+	noRange  bool
+	failing  bool
+}
+
+func newTestServer(size int) *testServer {
+	s := &testServer{content: make([]byte, size)}
+	for i := range s.content {
+		s.content[i] = byte(i * 13)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+// Write counts the bytes before writing them, so the count is complete once the client has read them.
+func (w countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+func (s *testServer) serve(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&s.requests, 1)
+	running := atomic.AddInt64(&s.running, 1)
+	defer atomic.AddInt64(&s.running, -1)
+	s.mu.Lock()
+	if running > s.peak {
+		s.peak = running
+	}
+	noRange, failing := s.noRange, s.failing
+	s.mu.Unlock()
+	if failing {
+		http.Error(w, "failing", http.StatusInternalServerError)
+		return
+	}
+	// slow down a little, so the connections overlap.
+	time.Sleep(10 * time.Millisecond)
+	w = countingWriter{ResponseWriter: w, n: &s.sent}
+	if noRange {
+		w.Write(s.content)
+		return
+	}
+	http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(s.content))
+}
+
+func (s *testServer) Requests() int64 { return atomic.LoadInt64(&s.requests) }
+
+func (s *testServer) Sent() int64 { return atomic.LoadInt64(&s.sent) }
+
+func (s *testServer) Peak() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func checkFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("downloaded %d bytes, want the content of %d bytes", len(b), len(content))
+	}
+	for _, name := range []string{path + ".part", path + ".part.json"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s is not removed", name)
+		}
+	}
+}
+
+func TestEngine_Download(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var completed int64
+	e := NewEngine(WithConnections(4), WithMinSegmentSize(1<<10), WithProgress(func(path string, n, total int64) {
+		atomic.StoreInt64(&completed, n)
+	}))
+	path := filepath.Join(dir, "sub", "file.bin")
+	if err := e.Download(context.Background(), path, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, srv.content)
+	// a probe and 4 segments.
+	if srv.Requests() != 5 || srv.Peak() < 2 {
+		t.Errorf("requests = %d, peak connections = %d, want 5 requests and concurrent connections", srv.Requests(), srv.Peak())
+	}
+	if completed != int64(len(srv.content)) {
+		t.Errorf("completed = %d, want %d", completed, len(srv.content))
+	}
+}
+
+func TestEngine_Download_Empty(t *testing.T) {
+	srv := newTestServer(0)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "empty")
+	if err := NewEngine().Download(context.Background(), path, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, nil)
+}
+
+func TestEngine_Download_NoRange(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	srv.noRange = true
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.bin")
+	if err := NewEngine(WithMinSegmentSize(1<<10)).Download(context.Background(), path, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, srv.content)
+	if srv.Requests() != 2 {
+		t.Errorf("requests = %d, want a probe and a download", srv.Requests())
+	}
+}
+
+func TestEngine_Download_Resume(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.bin")
+
+	// a partial download of 2 segments, the first is finished and the second is half done.
+	size := int64(len(srv.content))
+	part := make([]byte, size)
+	copy(part, srv.content[:size/2+size/4])
+	if err := ioutil.WriteFile(path+".part", part, 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := &state{Size: size, Segments: []*segment{
+		{Start: 0, End: size / 2, Done: size / 2},
+		{Start: size / 2, End: size, Done: size / 4},
+	}}
+	b, _ := json.Marshal(st)
+	if err := ioutil.WriteFile(path+".part.json", b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewEngine(WithMinSegmentSize(1<<10)).Download(context.Background(), path, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, srv.content)
+	// the probe sends 1 byte.
+	if want := size/4 + 1; srv.Sent() != want {
+		t.Errorf("sent %d bytes, want %d", srv.Sent(), want)
+	}
+}
+
+func TestEngine_Download_Interrupt(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.bin")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	e := NewEngine(WithMinSegmentSize(1<<10), WithBandwidth(64<<10))
+	if err := e.Download(ctx, path, srv.URL); err != context.DeadlineExceeded {
+		t.Fatalf("Download() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	b, err := ioutil.ReadFile(path + ".part.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := new(state)
+	if err := json.Unmarshal(b, st); err != nil {
+		t.Fatal(err)
+	}
+	if done := st.completed(); done == 0 || done >= int64(len(srv.content)) {
+		t.Errorf("completed %d bytes of the interrupted download", done)
+	}
+
+	sent := srv.Sent()
+	if err := NewEngine().Download(context.Background(), path, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, srv.content)
+	if resumed := srv.Sent() - sent; resumed >= int64(len(srv.content)) {
+		t.Errorf("resumed download sent %d bytes, want less than the whole file", resumed)
+	}
+}
+
+func TestEngine_Download_Mirrors(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	bad := newTestServer(0)
+	defer bad.Close()
+	bad.failing = true
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.bin")
+	e := NewEngine(WithMinSegmentSize(1 << 10))
+	if err := e.Download(context.Background(), path, bad.URL, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, srv.content)
+
+	if err := e.Download(context.Background(), filepath.Join(dir, "bad"), bad.URL); err == nil {
+		t.Error("Download() from a failing server succeeded")
+	}
+}
+
+func TestEngine_MaxConnections(t *testing.T) {
+	srv := newTestServer(64 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	e := NewEngine(WithConnections(4), WithMaxConnections(1), WithMinSegmentSize(1<<10))
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := e.Download(context.Background(), filepath.Join(dir, name), srv.URL); err != nil {
+				t.Error(err)
+			}
+		}(name)
+	}
+	wg.Wait()
+	// probes are not limited, so at most 2 probes and a segment run at the same time.
+	if srv.Peak() > 3 {
+		t.Errorf("peak connections = %d, want at most 3", srv.Peak())
+	}
+}
+
+func TestEngine_Bandwidth(t *testing.T) {
+	srv := newTestServer(16 << 10)
+	defer srv.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	start := time.Now()
+	path := filepath.Join(dir, "file.bin")
+	if err := NewEngine(WithBandwidth(32<<10)).Download(context.Background(), path, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, srv.content)
+	// 16 KiB at 32 KiB/s takes about 500ms.
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("download took %s, want about 500ms", d)
+	}
+}
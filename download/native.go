@@ -0,0 +1,177 @@
+package download
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type nativeDownloader struct {
+	e      *Engine
+	dir    string
+	events *EventQueue
+	ctx    context.Context
+	cancel context.CancelFunc
+	lastID uint64
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	tasks map[string]*nativeTask
+}
+
+type nativeTask struct {
+	req *Request
+	// path is the local path of the file in the directory.
+	path   string
+	status Status
+	// stop cancels the running download, nil if it's not running.
+	stop context.CancelFunc
+	// done is closed when the running download returns.
+	done chan struct{}
+}
+
+// NewNativeDownloader returns a Downloader running the downloads by the engine in the directory.
+// All downloads run at once, the connections are limited by the options of the engine.
+func NewNativeDownloader(e *Engine, dir string) Downloader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &nativeDownloader{
+		e:      e,
+		dir:    dir,
+		events: NewEventQueue(),
+		ctx:    ctx,
+		cancel: cancel,
+		tasks:  make(map[string]*nativeTask),
+	}
+}
+
+func (d *nativeDownloader) Add(ctx context.Context, req *Request) (string, error) {
+	if err := d.ctx.Err(); err != nil {
+		return "", err
+	}
+	path, err := localPath(d.dir, req.Path)
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&d.lastID, 1), 10)
+	t := &nativeTask{req: req, path: path, status: Status{ID: id, State: StateWaiting, Total: -1}}
+	d.mu.Lock()
+	d.tasks[id] = t
+	d.start(id, t)
+	d.mu.Unlock()
+	return id, nil
+}
+
+// start runs the download of the task, it must be called with mu held.
+func (d *nativeDownloader) start(id string, t *nativeTask) {
+	ctx, stop := context.WithCancel(d.ctx)
+	t.stop, t.done = stop, make(chan struct{})
+	d.setState(id, t, StateActive, nil)
+	d.wg.Add(1)
+	go func(done chan struct{}) {
+		defer d.wg.Done()
+		defer close(done)
+		err := d.e.download(ctx, t.path, func(_ string, completed, total int64) {
+			d.mu.Lock()
+			t.status.Completed, t.status.Total = completed, total
+			d.mu.Unlock()
+		}, t.req.URLs)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		t.stop = nil
+		switch {
+		case ctx.Err() != nil:
+			// stopped by Pause, Cancel or Close, which set the state.
+		case err != nil:
+			d.setState(id, t, StateError, err)
+		default:
+			d.setState(id, t, StateComplete, nil)
+		}
+	}(t.done)
+}
+
+// setState changes the state of the task and sends the event, the task is forgotten once it's finished,
+// so the tasks of a long run are not kept. It must be called with mu held.
+func (d *nativeDownloader) setState(id string, t *nativeTask, state State, err error) {
+	t.status.State, t.status.Err = state, err
+	if state.Finished() {
+		delete(d.tasks, id)
+	}
+	d.events.Send(Event{ID: id, State: state, Err: err})
+}
+
+func (d *nativeDownloader) Status(ctx context.Context, id string) (*Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	status := t.status
+	return &status, nil
+}
+
+// stop stops the running download of the task and waits for it, the state is set to the given one.
+func (d *nativeDownloader) stop(id string, state State) error {
+	d.mu.Lock()
+	t, ok := d.tasks[id]
+	if !ok {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	if t.status.State.Finished() {
+		d.mu.Unlock()
+		return nil
+	}
+	stop, done := t.stop, t.done
+	d.setState(id, t, state, nil)
+	d.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+	return nil
+}
+
+func (d *nativeDownloader) Cancel(ctx context.Context, id string) error {
+	return d.stop(id, StateCanceled)
+}
+
+func (d *nativeDownloader) Pause(ctx context.Context, id string) error {
+	return d.stop(id, StatePaused)
+}
+
+func (d *nativeDownloader) Resume(ctx context.Context, id string) error {
+	d.mu.Lock()
+	t, ok := d.tasks[id]
+	if !ok {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	if t.status.State != StatePaused {
+		d.mu.Unlock()
+		return nil
+	}
+	done := t.done
+	d.mu.Unlock()
+	// the paused download may be still writing the part file.
+	<-done
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.status.State == StatePaused && t.stop == nil {
+		d.start(id, t)
+	}
+	return nil
+}
+
+func (d *nativeDownloader) Events() <-chan Event {
+	return d.events.C()
+}
+
+// Close stops all downloads, the partial downloads are resumed by the next Add of the same path.
+func (d *nativeDownloader) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	d.events.Close()
+	return nil
+}
@@ -0,0 +1,91 @@
+package download
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// state is the progress of a download saved in the sidecar file of the ".part" file.
+type state struct {
+	// Size is the size of the file, -1 if it's unknown.
+	Size     int64      `json:"size"`
+	Segments []*segment `json:"segments"`
+}
+
+// segment is a range of the file downloaded by a connection.
+type segment struct {
+	Start int64 `json:"start"`
+	// End is exclusive, -1 means the end of the file of unknown size.
+	End int64 `json:"end"`
+	// Done is the count of bytes downloaded from Start.
+	Done int64 `json:"done"`
+}
+
+func (s *segment) finished() bool {
+	return s.End >= 0 && s.Start+s.Done >= s.End
+}
+
+// newState splits the file to n segments of the same size, the last one takes the rest.
+func newState(size int64, n int) *state {
+	st := &state{Size: size}
+	if size < 0 {
+		st.Segments = []*segment{{Start: 0, End: -1}}
+		return st
+	}
+	step := size / int64(n)
+	for i := 0; i < n; i++ {
+		seg := &segment{Start: int64(i) * step, End: int64(i+1) * step}
+		if i == n-1 {
+			seg.End = size
+		}
+		st.Segments = append(st.Segments, seg)
+	}
+	return st
+}
+
+// loadState loads the state of the partial download, nil is returned if there is no valid state of the size.
+func loadState(statePath, partPath string, size int64) *state {
+	if size < 0 {
+		return nil
+	}
+	info, err := os.Stat(partPath)
+	if err != nil || info.Size() != size {
+		return nil
+	}
+	b, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	st := new(state)
+	if err := json.Unmarshal(b, st); err != nil || st.Size != size || len(st.Segments) == 0 {
+		return nil
+	}
+	for _, seg := range st.Segments {
+		if seg.Start < 0 || seg.End > size || seg.Done < 0 || seg.Start+seg.Done > seg.End {
+			return nil
+		}
+	}
+	return st
+}
+
+func (st *state) completed() int64 {
+	var n int64
+	for _, seg := range st.Segments {
+		n += seg.Done
+	}
+	return n
+}
+
+// save writes the state to a temporary file and renames it, so a crash never leaves a broken state.
+func (st *state) save(path string) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
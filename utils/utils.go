@@ -1,8 +1,14 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 func Match1(re, str string) string {
@@ -31,3 +37,38 @@ func Map2slice(m map[string]string) []string {
 	}
 	return s
 }
+
+// WaitN waits until the limiter allows n events, or returns ctx.Err() once the context is done,
+// the reservation is canceled then. No goroutine is left behind by a canceled wait.
+func WaitN(ctx context.Context, l *rate.Limiter, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := l.ReserveN(time.Now(), n)
+	if !r.OK() {
+		return fmt.Errorf("%d events exceed the burst %d of the limiter", n, l.Burst())
+	}
+	d := r.Delay()
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// ParseContentRange returns the complete length of the Content-Range header like "bytes 0-99/1000".
+func ParseContentRange(s string) (int64, bool) {
+	i := strings.LastIndex(s, "/")
+	if i < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(s[i+1:], 10, 64)
+	return size, err == nil
+}